@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// /login no exige token, y cada intento calcula un hash PBKDF2 costoso. Para
+// que un cliente sin credenciales no pueda agotar la CPU, los intentos se
+// limitan por IP y en total.
+var (
+	LoginBurst       = 5                // Intentos seguidos permitidos por IP
+	LoginRefill      = 12 * time.Second // Tiempo para recuperar un intento
+	LoginConcurrency = 2                // Hashes de contraseña calculados a la vez
+)
+
+// maxLoginClients es la cantidad de IPs recordadas por el limitador
+const maxLoginClients = 10000
+
+// loginLimiter limita los intentos de /login con un balde de intentos por IP
+// y un semáforo que acota los hashes simultáneos
+type loginLimiter struct {
+	mu       sync.Mutex
+	clientes map[string]*balde
+	hashing  chan struct{}
+}
+
+// balde son los intentos disponibles de una IP
+type balde struct {
+	intentos float64
+	ultimo   time.Time
+}
+
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{
+		clientes: make(map[string]*balde),
+		hashing:  make(chan struct{}, max(LoginConcurrency, 1)),
+	}
+}
+
+// permitir descuenta un intento de la IP. Si no le quedan retorna false y el
+// tiempo que debe esperar.
+func (l *loginLimiter) permitir(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.clientes[ip]
+	if !ok {
+		if len(l.clientes) >= maxLoginClients {
+			l.podar(now)
+		}
+		b = &balde{intentos: float64(LoginBurst), ultimo: now}
+		l.clientes[ip] = b
+	}
+	b.intentos = min(float64(LoginBurst), b.intentos+float64(now.Sub(b.ultimo))/float64(LoginRefill))
+	b.ultimo = now
+	if b.intentos < 1 {
+		return false, time.Duration((1 - b.intentos) * float64(LoginRefill))
+	}
+	b.intentos--
+	return true, 0
+}
+
+// podar olvida las IPs que ya recuperaron todos sus intentos. Si ninguna lo
+// hizo, olvida todas: es preferible a crecer sin límite. Debe llamarse con mu tomado.
+func (l *loginLimiter) podar(now time.Time) {
+	lleno := time.Duration(LoginBurst) * LoginRefill
+	for ip, b := range l.clientes {
+		if now.Sub(b.ultimo) >= lleno {
+			delete(l.clientes, ip)
+		}
+	}
+	if len(l.clientes) >= maxLoginClients {
+		clear(l.clientes)
+	}
+}
+
+// limitar envuelve el manejador de /login con los límites de intentos
+func (l *loginLimiter) limitar(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		if ok, wait := l.permitir(ip, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "Demasiados intentos", http.StatusTooManyRequests)
+			return
+		}
+
+		select {
+		case l.hashing <- struct{}{}:
+			defer func() { <-l.hashing }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Servidor ocupado", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
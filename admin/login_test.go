@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterPerIP(t *testing.T) {
+	l := newLoginLimiter()
+	now := time.Now()
+	for i := range LoginBurst {
+		if ok, _ := l.permitir("10.0.0.1", now); !ok {
+			t.Fatalf("intento %d rechazado", i+1)
+		}
+	}
+	ok, wait := l.permitir("10.0.0.1", now)
+	if ok {
+		t.Fatal("se permitió un intento por sobre el límite")
+	}
+	if wait <= 0 || wait > LoginRefill {
+		t.Errorf("espera = %s", wait)
+	}
+
+	// Otra IP no se ve afectada, y la primera recupera un intento con el tiempo
+	if ok, _ := l.permitir("10.0.0.2", now); !ok {
+		t.Error("se rechazó a otra IP")
+	}
+	if ok, _ := l.permitir("10.0.0.1", now.Add(LoginRefill)); !ok {
+		t.Error("no se recuperó el intento")
+	}
+}
+
+func TestLoginRateLimited(t *testing.T) {
+	s := &Server{Secret: "secreto"}
+	handler := s.Handler()
+
+	var codes []int
+	for range LoginBurst + 1 {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user":"a","password":"b"}`))
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	// Sin usuarios /login está deshabilitado, pero los intentos igual cuentan
+	for i, code := range codes[:LoginBurst] {
+		if code != http.StatusNotFound {
+			t.Errorf("intento %d: código %d, se esperaba 404", i+1, code)
+		}
+	}
+	if last := codes[LoginBurst]; last != http.StatusTooManyRequests {
+		t.Errorf("último intento: código %d, se esperaba 429", last)
+	}
+}
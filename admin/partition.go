@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// handleGetPartition retorna la partición actual y los mensajes descartados
+func (s *Server) handleGetPartition(w http.ResponseWriter, r *http.Request) {
+	if s.Faults == nil {
+		http.Error(w, "Inyección de fallas deshabilitada", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"partition": node.FormatPartition(s.Faults.CurrentPartition()),
+		"dropped":   s.Faults.Dropped(),
+	})
+}
+
+// handleSetPartition aplica una partición, opcionalmente por un tiempo limitado.
+// La partición es unidireccional: solo descarta los mensajes que envía este
+// nodo, y los de los otros grupos hacia él siguen llegando hasta que se
+// aplique la misma partición en cada nodo.
+func (s *Server) handleSetPartition(w http.ResponseWriter, r *http.Request) {
+	if s.Faults == nil {
+		http.Error(w, "Inyección de fallas deshabilitada", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Groups   string `json:"groups"`   // Ej: "8000 | 8001,8002"
+		Duration string `json:"duration"` // Curación automática (vacío la mantiene)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Solicitud inválida", http.StatusBadRequest)
+		return
+	}
+
+	groups, err := node.ParsePartition(req.Groups)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Duration == "" {
+		s.Faults.Partition(groups...)
+	} else {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, "Duración inválida", http.StatusBadRequest)
+			return
+		}
+		s.Faults.PartitionFor(d, groups...)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"partition": node.FormatPartition(groups),
+		"duration":  req.Duration,
+	})
+}
+
+// handleHealPartition elimina la partición actual
+func (s *Server) handleHealPartition(w http.ResponseWriter, r *http.Request) {
+	if s.Faults == nil {
+		http.Error(w, "Inyección de fallas deshabilitada", http.StatusNotFound)
+		return
+	}
+
+	s.Faults.Heal()
+	writeJSON(w, http.StatusOK, map[string]string{"status": "curada"})
+}
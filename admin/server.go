@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"solemne3_SO/node"
+	"solemne3_SO/sync"
+	"solemne3_SO/utils"
+)
+
+// Server expone la API HTTP de administración de un nodo.
+// Todas las rutas salvo /health y /login exigen un token válido. /login solo
+// se habilita con Users y sus intentos se limitan por IP (ver LoginBurst).
+type Server struct {
+	Node         *node.Node
+	Logical      *sync.RelojLógico
+	Secret       string               // Clave para firmar y validar tokens
+	Users        *utils.PasswordStore // Usuarios habilitados para /login (nil lo deshabilita)
+	SyncRound    func() error         // Ejecuta una ronda de sincronización
+	Algorithm    func() string        // Retorna el algoritmo actual
+	SetAlgorithm func(name string) error
+	Faults       *node.Faults      // Fallas de red inyectadas (nil deshabilita /partition)
+	Snapshots    *sync.Snapshotter // Instantáneas globales (nil deshabilita /snapshot)
+}
+
+// Handler construye el enrutador HTTP de la API
+func (s *Server) Handler() http.Handler {
+	protected := http.NewServeMux()
+	protected.HandleFunc("GET /clock", s.handleClock)
+	protected.HandleFunc("GET /peers", s.handlePeers)
+	protected.HandleFunc("POST /sync", s.handleSync)
+	protected.HandleFunc("GET /algorithm", s.handleGetAlgorithm)
+	protected.HandleFunc("PUT /algorithm", s.handleSetAlgorithm)
+	protected.HandleFunc("GET /partition", s.handleGetPartition)
+	protected.HandleFunc("POST /partition", s.handleSetPartition)
+	protected.HandleFunc("DELETE /partition", s.handleHealPartition)
+	protected.HandleFunc("POST /snapshot", s.handleSnapshot)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("POST /login", newLoginLimiter().limitar(s.handleLogin))
+	mux.Handle("/", utils.ValidateTokenMiddleware(s.Secret)(protected))
+	return mux
+}
+
+// HTTPServer crea el servidor HTTP de la API con límites de tiempo, para que
+// un cliente lento no retenga conexiones indefinidamente
+func (s *Server) HTTPServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      maxSnapshotTimeout + 30*time.Second,
+		IdleTimeout:       time.Minute,
+	}
+}
+
+// handleHealth informa que el nodo está activo (sin autenticación)
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status": "ok",
+		"node":   s.Node.Name,
+	})
+}
+
+// handleLogin entrega un token a un usuario con credenciales válidas
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if s.Users == nil {
+		http.Error(w, "Login deshabilitado", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Solicitud inválida", http.StatusBadRequest)
+		return
+	}
+
+	if !s.Users.Authenticate(req.User, req.Password) {
+		http.Error(w, "Credenciales inválidas", http.StatusUnauthorized)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"token": utils.GenerateToken(req.User, s.Secret),
+	})
+}
+
+// handleClock retorna el reloj físico, su intervalo de incertidumbre, la
+// corrección gradual pendiente, el reloj lógico y el historial de ajustes
+func (s *Server) handleClock(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{
+		"node":    s.Node.Name,
+		"clock":   s.Node.GetClock().Format(time.RFC3339Nano),
+		"offsets": s.Node.OffsetHistory(),
+	}
+	if interval, err := s.Node.NowInterval(); err == nil {
+		resp["interval"] = interval
+		resp["uncertainty"] = interval.Uncertainty().String()
+	}
+	if pending := s.Node.PendingCorrection(); pending != 0 {
+		resp["pending_correction"] = pending.String()
+	}
+	if s.Logical != nil {
+		resp["logical"] = s.Logical.Get()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handlePeers lista los pares y su estado de salud
+func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Node.PeerHealth())
+}
+
+// handleSync ejecuta una ronda de sincronización a pedido
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if err := s.SyncRound(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	nodeID, _ := utils.NodeIDFromContext(r.Context())
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status":       "sincronizado",
+		"algorithm":    s.Algorithm(),
+		"requested_by": nodeID,
+	})
+}
+
+// handleGetAlgorithm retorna el algoritmo de sincronización actual
+func (s *Server) handleGetAlgorithm(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"algorithm": s.Algorithm()})
+}
+
+// handleSetAlgorithm cambia el algoritmo de sincronización en tiempo de ejecución
+func (s *Server) handleSetAlgorithm(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Algorithm string `json:"algorithm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Solicitud inválida", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.SetAlgorithm(req.Algorithm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"algorithm": s.Algorithm()})
+}
+
+// writeJSON serializa una respuesta JSON con el código indicado
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
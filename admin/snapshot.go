@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// snapshotTimeout es la espera por omisión del estado de todos los nodos
+const snapshotTimeout = 10 * time.Second
+
+// maxSnapshotTimeout es la espera máxima que se puede pedir, menor que el
+// tiempo de escritura del servidor HTTP
+const maxSnapshotTimeout = time.Minute
+
+// handleSnapshot inicia una instantánea global desde este nodo y retorna el
+// documento con el estado de todos los nodos y los mensajes en tránsito.
+// El parámetro timeout limita la espera (por ejemplo ?timeout=5s, hasta un minuto).
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.Snapshots == nil {
+		http.Error(w, "Instantáneas deshabilitadas", http.StatusNotFound)
+		return
+	}
+
+	timeout := snapshotTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > maxSnapshotTimeout {
+			http.Error(w, "Timeout inválido", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// Si algún nodo no responde a tiempo se retorna lo recolectado
+	snapshot, err := s.Snapshots.Take(ctx)
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusGatewayTimeout
+	}
+	writeJSON(w, status, snapshot)
+}
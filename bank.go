@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"solemne3_SO/node"
+	"solemne3_SO/sync"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"text/tabwriter"
+	"time"
+)
+
+// cuentaReplicada es la réplica de la cuenta bancaria que mantiene cada nodo
+type cuentaReplicada struct {
+	mu          gosync.Mutex
+	saldo       float64
+	operaciones []string // Operaciones aplicadas, en orden
+	aplicadas   chan struct{}
+}
+
+// aplicar ejecuta una operación "DEPOSITO:monto" o "INTERES:porcentaje"
+func (c *cuentaReplicada) aplicar(op string) {
+	kind, value, _ := strings.Cut(op, ":")
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	switch kind {
+	case "DEPOSITO":
+		c.saldo += amount
+	case "INTERES":
+		c.saldo += c.saldo * amount / 100
+	}
+	c.operaciones = append(c.operaciones, op)
+	c.mu.Unlock()
+
+	c.aplicadas <- struct{}{}
+}
+
+// runBank implementa el subcomando "bank": la demostración de la cuenta
+// bancaria replicada. Cada nodo emite depósitos e intereses sobre su réplica;
+// con multidifusión totalmente ordenada todas las réplicas aplican las
+// operaciones en el mismo orden y terminan con el mismo saldo.
+func runBank(args []string) {
+	fs := flag.NewFlagSet("bank", flag.ExitOnError)
+	count := fs.Int("nodes", 3, "Cantidad de réplicas")
+	ops := fs.Int("ops", 10, "Operaciones que emite cada réplica")
+	initial := fs.Float64("balance", 1000, "Saldo inicial de la cuenta")
+	seed := fs.Uint64("seed", 1, "Semilla para elegir las operaciones")
+	unordered := fs.Bool("unordered", false, "Aplicar las operaciones al recibirlas, sin orden total")
+	timeout := fs.Duration("timeout", 30*time.Second, "Tiempo máximo de espera de las entregas")
+	faultsFile := fs.String("faults", "", "Archivo JSON con las fallas de red a inyectar entre las réplicas")
+	logLevel := fs.String("log-level", "warn", "Nivel de log (debug|info|warn|error)")
+	fs.Parse(args)
+
+	if err := setupLogger(*logLevel, "text"); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *count < 1 {
+		fmt.Println("Error: --nodes debe ser al menos 1")
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, transport, err := loadClusterFaults(*faultsFile)
+	if err != nil {
+		fmt.Println("Error cargando fallas de red:", err)
+		os.Exit(1)
+	}
+
+	nodes, err := startLocalNodes(ctx, *count, 0, transport, nil)
+	if err != nil {
+		fmt.Println("Error iniciando nodo:", err)
+		os.Exit(1)
+	}
+
+	total := *count * *ops
+	cuentas := make([]*cuentaReplicada, *count)
+	emitir := make([]func(op string) error, *count)
+	for i, n := range nodes {
+		cuenta := &cuentaReplicada{saldo: *initial, aplicadas: make(chan struct{}, total)}
+		cuentas[i] = cuenta
+
+		if *unordered {
+			// Sin orden total cada réplica aplica las operaciones según llegan
+			n.RegisterHandler("BANCO:", func(message string, conn net.Conn) {
+				cuenta.aplicar(strings.TrimPrefix(message, "BANCO:"))
+			})
+			emitir[i] = func(op string) error {
+				cuenta.aplicar(op)
+				n.BroadcastMessage("BANCO:" + op)
+				return nil
+			}
+			continue
+		}
+
+		multicast := sync.NewTotalOrderMulticast(n, func(from, content string, timestamp int) {
+			cuenta.aplicar(content)
+		})
+		defer multicast.Close()
+		emitir[i] = multicast.Multicast
+	}
+
+	// Cada réplica emite sus operaciones en paralelo con las demás
+	rng := rand.New(rand.NewPCG(*seed, *seed))
+	var wg gosync.WaitGroup
+	for i := range nodes {
+		plan := make([]string, *ops)
+		for j := range plan {
+			if rng.IntN(2) == 0 {
+				plan[j] = "DEPOSITO:" + strconv.Itoa(10*(1+rng.IntN(10)))
+			} else {
+				plan[j] = "INTERES:" + strconv.Itoa(1+rng.IntN(5))
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, op := range plan {
+				if err := emitir[i](op); err != nil {
+					nodes[i].Logger.Warn("no se pudo emitir la operación", "op", op, "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Esperar que todas las réplicas apliquen todas las operaciones
+	deadline := time.After(*timeout)
+esperar:
+	for i, cuenta := range cuentas {
+		for range total {
+			select {
+			case <-cuenta.aplicadas:
+			case <-deadline:
+				fmt.Printf("Tiempo agotado: la réplica %s no aplicó todas las operaciones\n\n", nodes[i].Name)
+				break esperar
+			}
+		}
+	}
+
+	printBankSummary(nodes, cuentas, *unordered)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	cancel()
+	for _, n := range nodes {
+		n.Shutdown(shutdownCtx)
+	}
+}
+
+// printBankSummary muestra el saldo final de cada réplica e indica si todas
+// aplicaron las operaciones en el mismo orden
+func printBankSummary(nodes []*node.Node, cuentas []*cuentaReplicada, unordered bool) {
+	mode := "orden total"
+	if unordered {
+		mode = "sin orden"
+	}
+	fmt.Printf("Cuenta replicada en %d nodos (%s)\n\n", len(nodes), mode)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "RÉPLICA\tOPERACIONES\tSALDO\tPRIMERAS OPERACIONES\t")
+
+	consistent := true
+	var reference string
+	for i, cuenta := range cuentas {
+		cuenta.mu.Lock()
+		history := strings.Join(cuenta.operaciones, " ")
+		first := cuenta.operaciones[:min(3, len(cuenta.operaciones))]
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%s\t\n", nodes[i].Name, len(cuenta.operaciones), cuenta.saldo, strings.Join(first, " "))
+		cuenta.mu.Unlock()
+
+		if i == 0 {
+			reference = history
+		} else if history != reference {
+			consistent = false
+		}
+	}
+	w.Flush()
+
+	fmt.Println()
+	if consistent {
+		fmt.Println("Réplicas consistentes: todas aplicaron las operaciones en el mismo orden")
+	} else {
+		fmt.Println("Réplicas inconsistentes: el orden de las operaciones difiere entre réplicas")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"solemne3_SO/config"
+	"solemne3_SO/utils"
+)
+
+// runCerts implementa el subcomando "certs": crea la CA del clúster (o
+// reutiliza la existente) y un certificado por cada nodo definido en la configuración
+func runCerts(args []string) {
+	fs := flag.NewFlagSet("certs", flag.ExitOnError)
+	dir := fs.String("dir", "certs", "Directorio donde se guardan la CA y los certificados")
+	force := fs.Bool("force", false, "Crear una CA nueva aunque ya exista (invalida los certificados emitidos antes)")
+	fs.Parse(args)
+
+	created, err := utils.EnsureCA(*dir, *force)
+	if err != nil {
+		fmt.Println("Error preparando la CA:", err)
+		os.Exit(1)
+	}
+	if created {
+		fmt.Println("CA creada en", *dir)
+	} else {
+		fmt.Println("Usando la CA existente en", *dir)
+	}
+
+	for _, address := range config.NodeAddresses {
+		if err := utils.GenerateNodeCertificate(*dir, address); err != nil {
+			fmt.Println("Error creando certificado para", address, "-", err)
+			os.Exit(1)
+		}
+		fmt.Println("Certificado creado para", address)
+	}
+}
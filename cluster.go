@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"solemne3_SO/node"
+	"solemne3_SO/sync"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// clusterMember es un nodo del clúster local con su configuración inicial
+type clusterMember struct {
+	node      *node.Node
+	runner    *syncRunner
+	snapshots *sync.Snapshotter
+	skew      time.Duration // Desfase inicial respecto a la hora real
+	drift     float64       // Deriva del reloj en ppm
+}
+
+// runCluster implementa el subcomando "cluster": inicia N nodos en el mismo
+// proceso, cada uno con su propio listener, ejecuta el algoritmo durante el
+// tiempo indicado y muestra un resumen de los desfases finales
+func runCluster(args []string) {
+	fs := flag.NewFlagSet("cluster", flag.ExitOnError)
+	count := fs.Int("nodes", 3, "Cantidad de nodos del clúster")
+	algo := fs.String("algo", "cristian", "Algoritmo de sincronización")
+	interval := fs.Duration("interval", time.Second, "Intervalo entre rondas de sincronización (0 ejecuta una sola ronda)")
+	duration := fs.Duration("duration", 10*time.Second, "Duración del escenario")
+	skews := fs.String("skew", "", "Desfase inicial de cada nodo separado por comas, ej: 0s,2s,-1.5s")
+	drifts := fs.String("drift", "", "Deriva de cada nodo en ppm separada por comas, ej: 0,50,-100")
+	hlcMaxDrift := fs.Duration("hlc-max-drift", sync.HLCMaxDrift, "Con -algo hlc, adelanto máximo tolerado en las marcas recibidas (0 no limita)")
+	slew := addSlewFlags(fs)
+	leader := fs.Int("leader", -1, "Índice del único nodo que ejecuta rondas (-1 las ejecuta en todos, salvo con berkeley, que usa el nodo 0)")
+	basePort := fs.Int("base-port", 0, "Puerto del primer nodo; los demás usan los siguientes (0 elige puertos libres)")
+	faultsFile := fs.String("faults", "", "Archivo JSON con las fallas de red a inyectar entre los nodos")
+	snapshotFile := fs.String("snapshot", "", "Archivo donde se guarda una instantánea global tomada a mitad del escenario (\"-\" la muestra)")
+	logLevel := fs.String("log-level", "warn", "Nivel de log (debug|info|warn|error)")
+	logFormat := fs.String("log-format", "text", "Formato de log (text|json)")
+	fs.Parse(args)
+
+	if err := setupLogger(*logLevel, *logFormat); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if *count < 1 {
+		fmt.Println("Error: --nodes debe ser al menos 1")
+		os.Exit(1)
+	}
+	if err := slew.validate(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *leader >= *count {
+		fmt.Println("Error: --leader fuera de rango")
+		os.Exit(1)
+	}
+	if *leader < 0 && sync.NeedsCoordinator(*algo) {
+		// Con varios coordinadores los ajustes se superponen y los relojes divergen
+		*leader = 0
+	}
+
+	skewList, err := parseList(*skews, *count, time.ParseDuration)
+	if err != nil {
+		fmt.Println("Error en --skew:", err)
+		os.Exit(1)
+	}
+	driftList, err := parseList(*drifts, *count, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+	if err != nil {
+		fmt.Println("Error en --drift:", err)
+		os.Exit(1)
+	}
+
+	sync.HLCMaxDrift = *hlcMaxDrift
+
+	// El escenario termina al cumplirse la duración o al recibir SIGINT o SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	faults, transport, err := loadClusterFaults(*faultsFile)
+	if err != nil {
+		fmt.Println("Error cargando fallas de red:", err)
+		os.Exit(1)
+	}
+	if faults != nil && faults.NamesNodes() && *basePort == 0 {
+		// Con puertos libres las direcciones del archivo no corresponderían a ningún nodo
+		fmt.Println("Error: los enlaces y particiones de --faults indican nodos por dirección; use --base-port para fijar los puertos")
+		os.Exit(1)
+	}
+
+	// Iniciar los nodos
+	nodes, err := startLocalNodes(ctx, *count, *basePort, transport, func(i int, n *node.Node) {
+		n.Drift = driftList[i]
+		n.SetClock(time.Now().UTC().Add(skewList[i]))
+		// El desfase inicial se aplica con un salto antes de habilitar el ajuste gradual
+		slew.apply(n)
+	})
+	if err != nil {
+		fmt.Println("Error iniciando nodo:", err)
+		os.Exit(1)
+	}
+
+	members := make([]*clusterMember, *count)
+	for i, n := range nodes {
+		members[i] = &clusterMember{node: n, skew: skewList[i], drift: driftList[i]}
+	}
+
+	for _, m := range members {
+		runner, err := newSyncRunner(ctx, m.node, *algo)
+		if err != nil {
+			fmt.Println("Error iniciando algoritmo:", err)
+			os.Exit(1)
+		}
+		m.runner = runner
+		m.snapshots = sync.NewSnapshotter(m.node, snapshotState(m.node, runner))
+	}
+
+	fmt.Printf("Clúster de %d nodos con %s durante %s\n", *count, *algo, *duration)
+
+	if faults != nil {
+		faults.StartSchedule(ctx)
+	}
+
+	// Ejecutar las rondas en cada nodo (o solo en el líder)
+	for i, m := range members {
+		if *leader >= 0 && i != *leader {
+			continue
+		}
+		go func() {
+			if err := m.runner.SyncRound(); err != nil {
+				m.node.Logger.Warn("ronda de sincronización incompleta", "error", err)
+			}
+			if *interval > 0 {
+				m.runner.Run(*interval)
+			}
+		}()
+	}
+
+	if *snapshotFile != "" {
+		go takeClusterSnapshot(ctx, members[0].snapshots, *duration/2, *snapshotFile)
+	}
+
+	<-ctx.Done()
+
+	// Tomar el resumen antes de detener los nodos
+	now := time.Now()
+	finals := make([]time.Duration, len(members))
+	for i, m := range members {
+		finals[i] = m.node.GetClock().Sub(now)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	for _, m := range members {
+		if err := m.runner.Stop(); err != nil {
+			m.node.Logger.Warn("error deteniendo algoritmo", "error", err)
+		}
+		m.snapshots.Close()
+		m.node.Shutdown(shutdownCtx)
+	}
+
+	printClusterSummary(members, finals)
+	if faults != nil {
+		printDropped(faults.Dropped())
+	}
+}
+
+// takeClusterSnapshot toma una instantánea global desde el primer nodo después
+// de la espera indicada y la guarda como JSON en path ("-" la muestra)
+func takeClusterSnapshot(ctx context.Context, snapshots *sync.Snapshotter, after time.Duration, path string) {
+	select {
+	case <-time.After(after):
+	case <-ctx.Done():
+		return
+	}
+
+	takeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	snapshot, err := snapshots.Take(takeCtx)
+	if err != nil {
+		fmt.Println("Instantánea incompleta:", err)
+	}
+
+	data, _ := json.MarshalIndent(snapshot, "", "  ")
+	if path == "-" {
+		fmt.Println(string(data))
+		return
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		fmt.Println("Error guardando instantánea:", err)
+		return
+	}
+	fmt.Println("Instantánea global guardada en", path)
+}
+
+// printDropped resume los mensajes descartados por la inyección de fallas
+func printDropped(dropped []node.DroppedMessage) {
+	counts := make(map[string]int)
+	for _, d := range dropped {
+		counts[d.Reason+" "+d.From+" -> "+d.To+" "+d.Type]++
+	}
+	keys := slices.Sorted(maps.Keys(counts))
+
+	fmt.Println()
+	fmt.Println("Mensajes descartados:", len(dropped))
+	for _, k := range keys {
+		fmt.Printf("  %4d  %s\n", counts[k], k)
+	}
+}
+
+// loadClusterFaults carga el archivo de fallas (si se indica) y crea el
+// transporte que comparten todos los nodos del clúster local
+func loadClusterFaults(path string) (*node.Faults, node.Transport, error) {
+	if path == "" {
+		return nil, nil, nil
+	}
+	faults, err := node.LoadFaults(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return faults, node.NewFaultyTransport(node.TCPTransport{}, faults), nil
+}
+
+// startLocalNodes inicia count nodos en el proceso, cada uno con su listener,
+// y configura a cada uno con los demás como pares. Con basePort en cero se
+// eligen puertos libres. setup se llama con cada nodo antes de iniciarlo.
+func startLocalNodes(ctx context.Context, count, basePort int, transport node.Transport, setup func(i int, n *node.Node)) ([]*node.Node, error) {
+	nodes := make([]*node.Node, count)
+	addresses := make([]string, count)
+	for i := range nodes {
+		port := 0
+		if basePort > 0 {
+			port = basePort + i
+		}
+		n := node.NewNode("Nodo_"+strconv.Itoa(i), "localhost:"+strconv.Itoa(port), nil)
+		n.Transport = transport
+		if setup != nil {
+			setup(i, n)
+		}
+		if err := n.Start(ctx); err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+		addresses[i] = n.Address
+	}
+
+	for _, n := range nodes {
+		n.Peers = addresses
+	}
+	return nodes, nil
+}
+
+// printClusterSummary muestra el desfase final de cada nodo respecto a la hora
+// real y la dispersión entre el reloj más adelantado y el más atrasado
+func printClusterSummary(members []*clusterMember, finals []time.Duration) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "NODO\tDIRECCIÓN\tDESFASE INI\tDERIVA\tDESFASE FINAL\tINCERTIDUMBRE\tAJUSTES\t")
+
+	lowest, highest := finals[0], finals[0]
+	for i, m := range members {
+		uncertainty := "-"
+		if interval, err := m.node.NowInterval(); err == nil {
+			uncertainty = "±" + interval.Uncertainty().Round(time.Microsecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%sppm\t%s\t%s\t%d\t\n",
+			m.node.Name, m.node.Address, m.skew, strconv.FormatFloat(m.drift, 'f', -1, 64),
+			finals[i].Round(time.Microsecond), uncertainty, len(m.node.OffsetHistory()))
+		lowest = min(lowest, finals[i])
+		highest = max(highest, finals[i])
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Dispersión final:", (highest - lowest).Round(time.Microsecond))
+}
+
+// parseList interpreta una lista separada por comas con un valor por nodo.
+// Los nodos sin valor usan el valor cero.
+func parseList[T any](list string, count int, parse func(string) (T, error)) ([]T, error) {
+	values := make([]T, count)
+	if strings.TrimSpace(list) == "" {
+		return values, nil
+	}
+
+	items := strings.Split(list, ",")
+	if len(items) > count {
+		return nil, fmt.Errorf("se indicaron %d valores para %d nodos", len(items), count)
+	}
+	for i, item := range items {
+		value, err := parse(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
@@ -1,15 +1,50 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"solemne3_SO/admin"
 	"solemne3_SO/config"
+	"solemne3_SO/metrics"
 	"solemne3_SO/node"
 	"solemne3_SO/sync"
+	"solemne3_SO/utils"
+	"syscall"
 	"time"
 )
 
 func main() {
+	// ----- Subcommands -----
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "certs":
+			runCerts(os.Args[2:])
+			return
+		case "passwd":
+			runPasswd(os.Args[2:])
+			return
+		case "cluster":
+			runCluster(os.Args[2:])
+			return
+		case "sim":
+			runSimulate(os.Args[2:])
+			return
+		case "bank":
+			runBank(os.Args[2:])
+			return
+		case "mutex":
+			runMutex(os.Args[2:])
+			return
+		}
+	}
+
 	// ----- Port -----
 
 	// Definir flags
@@ -17,10 +52,77 @@ func main() {
 
 	// ----- Algorithm -----
 
-	algo := flag.String("algo", "cristian", "Algoritmo de sincronización (cristian|berkeley|logical|vector)")
+	algo := flag.String("algo", "cristian", "Algoritmo de sincronización (\"list\" muestra los disponibles)")
+	interval := flag.Duration("interval", 0, "Intervalo entre rondas de sincronización (0 ejecuta una sola ronda)")
+	hlcMaxDrift := flag.Duration("hlc-max-drift", sync.HLCMaxDrift, "Con --algo=hlc, adelanto máximo tolerado en las marcas recibidas (0 no limita)")
+	slew := addSlewFlags(flag.CommandLine)
+
+	// ----- TLS -----
+
+	tlsDir := flag.String("tls-dir", "", "Directorio con la CA y los certificados (vacío usa TCP sin cifrar)")
+
+	// ----- Session keys -----
+
+	sessionKeys := flag.Bool("session-keys", false, "Negociar claves de sesión ECDH por cada par de nodos")
+	keyRotation := flag.Duration("key-rotation", 0, "Intervalo de rotación de las claves de sesión (0 la deshabilita)")
+
+	// ----- Mutual exclusion -----
+
+	mutexAlgo := flag.String("mutex", "", "Estrategia de exclusión mutua distribuida (vacío la deshabilita, \"list\" muestra las disponibles)")
+	tokenTimeout := flag.Duration("token-timeout", sync.TokenTimeout, "Tiempo sin ver el token antes de regenerarlo (estrategia token)")
+
+	// ----- Fault injection -----
+
+	faultsFile := flag.String("faults", "", "Archivo JSON con las fallas de red a inyectar (latencia, pérdida, duplicación, reordenamiento, desconexiones)")
+
+	// ----- Admin API -----
+
+	adminAddr := flag.String("admin", "", "Dirección del API HTTP de administración, ej: localhost:9000 (vacío lo deshabilita)")
+	adminSecret := flag.String("admin-secret", "", "Clave para firmar y validar los tokens del API de administración")
+	adminTokenTTL := flag.Duration("admin-token-ttl", utils.TokenTTL, "Vigencia de los tokens entregados por /login")
+	adminUsers := flag.String("admin-users", "", "Archivo usuario:hash con las credenciales para /login")
+
+	// ----- Metrics -----
+
+	metricsAddr := flag.String("metrics", "", "Dirección donde se exponen las métricas Prometheus, ej: localhost:9100 (vacío lo deshabilita)")
+
+	// ----- Logging -----
+
+	logLevel := flag.String("log-level", "info", "Nivel de log (debug|info|warn|error)")
+	logFormat := flag.String("log-format", "text", "Formato de log (text|json)")
+
+	// ----- Shutdown -----
+
+	shutdownTimeout := flag.Duration("shutdown-timeout", 5*time.Second, "Tiempo máximo para terminar las conexiones en curso al detenerse")
 
 	flag.Parse()
 
+	// ----- Algorithm -----
+
+	if *algo == "list" {
+		for _, name := range sync.Names() {
+			fmt.Println(name)
+		}
+		return
+	}
+	if *mutexAlgo == "list" {
+		for _, name := range sync.MutexNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	// ----- Logging -----
+
+	if err := setupLogger(*logLevel, *logFormat); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := slew.validate(); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
 	// ----- Port -----
 
 	// Si no viene --port, revisar argumentos posicionales
@@ -36,42 +138,214 @@ func main() {
 	address := "localhost:" + *port
 	nombreNodo := "Nodo_" + *port
 
-	fmt.Printf("[%s] Iniciando en %s usando algoritmo %s\n", nombreNodo, address, *algo)
+	log := slog.Default().With("node", nombreNodo)
+	log.Info("iniciando nodo", "address", address, "algorithm", *algo)
 
 	// Crear nodo
 	peers := config.NodeAddresses
 	myNode := node.NewNode(nombreNodo, address, peers)
+	slew.apply(myNode)
+
+	// ----- TLS -----
+
+	if *tlsDir != "" {
+		tlsConfig, err := utils.LoadNodeTLSConfig(*tlsDir, address)
+		if err != nil {
+			log.Error("error cargando configuración TLS", "error", err)
+			os.Exit(1)
+		}
+		myNode.TLSConfig = tlsConfig
+		log.Info("TLS mutuo habilitado", "dir", *tlsDir)
+	}
+
+	// ----- Session keys -----
+
+	if *sessionKeys {
+		// La identidad de cada par se toma de su certificado TLS
+		if myNode.TLSConfig == nil {
+			log.Error("--session-keys requiere --tls-dir")
+			os.Exit(1)
+		}
+		sessions, err := utils.NewSessionManager(address)
+		if err != nil {
+			log.Error("error creando claves de sesión", "error", err)
+			os.Exit(1)
+		}
+		myNode.Sessions = sessions
+	}
+
+	// ----- Fault injection -----
+
+	// Con la API de administración las particiones se controlan desde /partition
+	var faults *node.Faults
+	if *faultsFile != "" {
+		var err error
+		faults, err = node.LoadFaults(*faultsFile)
+		if err != nil {
+			log.Error("error cargando fallas de red", "error", err)
+			os.Exit(1)
+		}
+		log.Warn("inyección de fallas de red habilitada", "file", *faultsFile)
+	} else if *adminAddr != "" {
+		faults = node.NewFaults(uint64(time.Now().UnixNano()))
+	}
+	if faults != nil {
+		myNode.Transport = node.NewFaultyTransport(node.TCPTransport{TLSConfig: myNode.TLSConfig}, faults)
+	}
 
-	// Iniciar listener en segundo plano
-	go myNode.StartListener()
+	// ----- Mutual exclusion -----
+
+	// El nodo responde las solicitudes de los pares aunque no pida la sección crítica
+	if *mutexAlgo != "" {
+		sync.TokenTimeout = *tokenTimeout
+		mutex, err := sync.NewMutex(*mutexAlgo, myNode)
+		if err != nil {
+			log.Error("error iniciando exclusión mutua", "error", err)
+			os.Exit(1)
+		}
+		defer mutex.Close()
+		myNode.Locker = mutex
+		log.Info("exclusión mutua distribuida habilitada", "algorithm", *mutexAlgo)
+	}
+
+	sync.HLCMaxDrift = *hlcMaxDrift
+
+	// Los resultados de cada sincronización se muestran en el log
+	sync.AddObserver(sync.LogObserver{})
+
+	// El contexto se cancela al recibir SIGINT o SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	runner, err := newSyncRunner(ctx, myNode, *algo)
+	if err != nil {
+		log.Error("error iniciando algoritmo", "error", err)
+		os.Exit(1)
+	}
+
+	// Todos los nodos responden a los marcadores de las instantáneas globales
+	snapshots := sync.NewSnapshotter(myNode, snapshotState(myNode, runner))
+	defer snapshots.Close()
+
+	// Servidores HTTP que se detienen junto con el nodo
+	var servers []*http.Server
+
+	// ----- Admin API -----
+
+	if *adminAddr != "" {
+		if *adminSecret == "" {
+			log.Error("--admin requiere --admin-secret")
+			os.Exit(1)
+		}
+		utils.TokenTTL = *adminTokenTTL
+
+		server := &admin.Server{
+			Node:         myNode,
+			Logical:      sync.RelojDeNodo(myNode),
+			Secret:       *adminSecret,
+			SyncRound:    runner.SyncRound,
+			Algorithm:    runner.Algorithm,
+			SetAlgorithm: runner.SetAlgorithm,
+			Faults:       faults,
+			Snapshots:    snapshots,
+		}
+
+		if *adminUsers != "" {
+			users, err := utils.LoadPasswordStore(*adminUsers)
+			if err != nil {
+				log.Error("error cargando usuarios del API", "error", err)
+				os.Exit(1)
+			}
+			server.Users = users
+		}
+
+		srv := server.HTTPServer(*adminAddr)
+		servers = append(servers, srv)
+		go func() {
+			log.Info("API de administración habilitada", "url", "http://"+*adminAddr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("error en API de administración", "error", err)
+			}
+		}()
+	}
+
+	// ----- Metrics -----
+
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		srv := &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		servers = append(servers, srv)
+		go func() {
+			log.Info("métricas habilitadas", "url", "http://"+*metricsAddr+"/metrics")
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("error en servidor de métricas", "error", err)
+			}
+		}()
+	}
+
+	// Abrir el puerto del nodo; el listener se cierra al cancelar ctx
+	if err := myNode.Start(ctx); err != nil {
+		log.Error("error iniciando listener", "error", err)
+		os.Exit(1)
+	}
+
+	// Las particiones programadas cuentan el tiempo desde que el nodo escucha
+	if faults != nil {
+		faults.StartSchedule(ctx)
+	}
 
 	// Esperar que los nodos estén listos
-	time.Sleep(2 * time.Second)
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+	}
 
-	// Sincronizar con todos los peers menos consigo mismo
-	for _, peer := range peers {
-		if peer != address {
-			fmt.Println("[" + nombreNodo + "] Sincronizando con " + peer)
-
-			// ----- Algorithm -----
-
-			switch *algo {
-			case "cristian":
-				sync.CristianSync(myNode, peer)
-			case "berkeley":
-				sync.BerkeleySync(myNode)
-			case "logical":
-				reloj := sync.NewRelojLogico()
-				sync.EnviarMensajeLogico(myNode, peer, reloj, "Hola desde "+nombreNodo)
-			case "vector":
-				fmt.Println("VectorClock pendiente.")
-			default:
-				fmt.Println("Algoritmo no reconocido: utilizando algoritmo cristian por defecto", *algo)
-				sync.CristianSync(myNode, peer)
+	// ----- Session keys -----
+
+	if myNode.Sessions != nil {
+		for _, peer := range peers {
+			if peer != address {
+				if err := myNode.ExchangeKeys(peer); err != nil {
+					log.Warn("no se pudo negociar la sesión", "peer", peer, "error", err)
+				}
 			}
 		}
+		if *keyRotation > 0 {
+			stopRotation := myNode.StartKeyRotation(*keyRotation)
+			defer stopRotation()
+		}
+	}
+
+	// Sincronizar con todos los peers menos consigo mismo
+	if ctx.Err() == nil {
+		if err := runner.SyncRound(); err != nil {
+			log.Warn("ronda de sincronización incompleta", "error", err)
+		}
+	}
+	if *interval > 0 {
+		runner.Run(*interval)
+	}
+
+	// Mantener activo hasta recibir SIGINT o SIGTERM
+	<-ctx.Done()
+	log.Info("deteniendo nodo", "timeout", *shutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+
+	if err := runner.Stop(); err != nil {
+		log.Warn("error deteniendo algoritmo", "error", err)
+	}
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Warn("error deteniendo servidor HTTP", "address", srv.Addr, "error", err)
+		}
+	}
+	if err := myNode.Shutdown(shutdownCtx); err != nil {
+		log.Warn("el nodo no terminó a tiempo", "error", err)
 	}
 
-	// Mantener activo
-	select {}
+	// Estado final del nodo
+	log.Info("estado final", "clock", myNode.GetClock(), "offsets", len(myNode.OffsetHistory()))
 }
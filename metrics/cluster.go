@@ -0,0 +1,45 @@
+package metrics
+
+import "time"
+
+// Buckets en segundos para tiempos de ida y vuelta y tamaños de ajuste
+var (
+	rttBuckets        = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	adjustmentBuckets = []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+	waitBuckets       = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+)
+
+// Métricas de sincronización y comunicación de los nodos
+var (
+	ClockOffset = NewGaugeVec("solemne3_clock_offset_seconds",
+		"Último desfase estimado entre el reloj local y el de cada par.", "node", "peer")
+	SyncRTT = NewHistogramVec("solemne3_sync_rtt_seconds",
+		"Tiempo de ida y vuelta de las solicitudes de hora.", rttBuckets, "node", "algorithm")
+	ClockAdjustment = NewHistogramVec("solemne3_clock_adjustment_seconds",
+		"Magnitud de los ajustes aplicados al reloj local.", adjustmentBuckets, "node", "algorithm")
+	SyncTotal = NewCounterVec("solemne3_sync_total",
+		"Sincronizaciones realizadas por resultado.", "node", "algorithm", "result")
+	MessagesTotal = NewCounterVec("solemne3_messages_total",
+		"Mensajes enviados y recibidos por tipo.", "node", "direction", "type")
+	LamportClock = NewGaugeVec("solemne3_lamport_clock",
+		"Valor actual del reloj lógico de Lamport.", "node")
+	MutexWait = NewHistogramVec("solemne3_mutex_wait_seconds",
+		"Tiempo de espera para entrar a la sección crítica distribuida.", waitBuckets, "node", "algorithm")
+	MutexMessages = NewCounterVec("solemne3_mutex_messages_total",
+		"Mensajes enviados por la exclusión mutua distribuida.", "node", "algorithm")
+)
+
+// SyncSucceeded registra una sincronización exitosa
+func SyncSucceeded(node, algorithm string) {
+	SyncTotal.Inc(node, algorithm, "success")
+}
+
+// SyncFailed registra una sincronización fallida
+func SyncFailed(node, algorithm string) {
+	SyncTotal.Inc(node, algorithm, "failure")
+}
+
+// ObserveAdjustment registra la magnitud de un ajuste de reloj
+func ObserveAdjustment(node, algorithm string, adjustment time.Duration) {
+	ClockAdjustment.Observe(adjustment.Abs().Seconds(), node, algorithm)
+}
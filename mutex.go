@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"solemne3_SO/node"
+	"solemne3_SO/sync"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// mutexTrial es el resultado de una estrategia de exclusión mutua en el subcomando "mutex"
+type mutexTrial struct {
+	algo        string
+	total       sync.MutexStats
+	fallidas    int32
+	violaciones int32
+}
+
+// runMutex implementa el subcomando "mutex": varios nodos en un solo proceso
+// compiten por la sección crítica distribuida y al final se muestran los
+// mensajes y tiempos de espera de cada uno. Con varias estrategias separadas
+// por comas se ejecutan una tras otra y se comparan.
+func runMutex(args []string) {
+	fs := flag.NewFlagSet("mutex", flag.ExitOnError)
+	count := fs.Int("nodes", 3, "Cantidad de nodos")
+	algo := fs.String("algo", "ricart", "Estrategias de exclusión mutua separadas por comas (\"list\" muestra las disponibles)")
+	entries := fs.Int("entries", 5, "Entradas a la sección crítica de cada nodo")
+	hold := fs.Duration("hold", 10*time.Millisecond, "Tiempo que cada nodo permanece en la sección crítica")
+	timeout := fs.Duration("timeout", 30*time.Second, "Tiempo máximo de espera de cada entrada")
+	tokenTimeout := fs.Duration("token-timeout", sync.TokenTimeout, "Tiempo sin ver el token antes de regenerarlo (estrategia token)")
+	faultsFile := fs.String("faults", "", "Archivo JSON con las fallas de red a inyectar entre los nodos")
+	logLevel := fs.String("log-level", "warn", "Nivel de log (debug|info|warn|error)")
+	fs.Parse(args)
+
+	if *algo == "list" {
+		for _, name := range sync.MutexNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+	if err := setupLogger(*logLevel, "text"); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *count < 1 {
+		fmt.Println("Error: --nodes debe ser al menos 1")
+		os.Exit(1)
+	}
+
+	sync.TokenTimeout = *tokenTimeout
+
+	_, transport, err := loadClusterFaults(*faultsFile)
+	if err != nil {
+		fmt.Println("Error cargando fallas de red:", err)
+		os.Exit(1)
+	}
+
+	var trials []mutexTrial
+	for i, name := range strings.Split(*algo, ",") {
+		if i > 0 {
+			fmt.Println()
+		}
+		trial, err := runMutexTrial(strings.TrimSpace(name), *count, *entries, *hold, *timeout, transport)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		trials = append(trials, trial)
+	}
+
+	if len(trials) > 1 {
+		printMutexComparison(trials, *count)
+	}
+}
+
+// runMutexTrial inicia los nodos con una estrategia, los hace competir por la
+// sección crítica y muestra sus estadísticas
+func runMutexTrial(algo string, count, entries int, hold, timeout time.Duration, transport node.Transport) (mutexTrial, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodes, err := startLocalNodes(ctx, count, 0, transport, nil)
+	if err != nil {
+		return mutexTrial{}, fmt.Errorf("iniciando nodo: %w", err)
+	}
+	defer func() {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		cancel()
+		for _, n := range nodes {
+			n.Shutdown(shutdownCtx)
+		}
+	}()
+
+	locks := make([]sync.Mutex, len(nodes))
+	for i, n := range nodes {
+		m, err := sync.NewMutex(algo, n)
+		if err != nil {
+			return mutexTrial{}, err
+		}
+		defer m.Close()
+		locks[i] = m
+		n.Locker = m
+	}
+
+	// Cada nodo entra a la sección crítica en paralelo con los demás; dentro
+	// se cuenta cuántos nodos hay a la vez para detectar violaciones
+	var dentro, violaciones, fallidas atomic.Int32
+	var wg gosync.WaitGroup
+	start := time.Now()
+	for _, n := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range entries {
+				lockCtx, cancelLock := context.WithTimeout(ctx, timeout)
+				err := n.Lock(lockCtx)
+				cancelLock()
+				if err != nil {
+					n.Logger.Warn("no se pudo entrar a la sección crítica", "error", err)
+					fallidas.Add(1)
+					continue
+				}
+				if dentro.Add(1) > 1 {
+					violaciones.Add(1)
+				}
+				time.Sleep(hold)
+				dentro.Add(-1)
+				if err := n.Unlock(); err != nil {
+					n.Logger.Warn("no se pudo salir de la sección crítica", "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	trial := mutexTrial{
+		algo:        algo,
+		total:       printMutexSummary(algo, nodes, locks, time.Since(start)),
+		fallidas:    fallidas.Load(),
+		violaciones: violaciones.Load(),
+	}
+	fmt.Println("Entradas fallidas:", trial.fallidas)
+	fmt.Println("Violaciones de exclusión mutua:", trial.violaciones)
+	return trial, nil
+}
+
+// printMutexSummary muestra las estadísticas de cada nodo y el costo total
+// en mensajes por entrada a la sección crítica, y retorna el total
+func printMutexSummary(algo string, nodes []*node.Node, locks []sync.Mutex, elapsed time.Duration) sync.MutexStats {
+	fmt.Printf("Exclusión mutua %s con %d nodos (%s)\n\n", algo, len(nodes), elapsed.Round(time.Millisecond))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "NODO\tENTRADAS\tMENSAJES\tMSJ/ENTRADA\tESPERA PROM\tESPERA MÁX\t")
+
+	var total sync.MutexStats
+	for i, m := range locks {
+		s := m.Stats()
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%s\t%s\t\n", nodes[i].Name, s.Entries, s.Messages,
+			s.MessagesPerEntry(), s.AverageWait().Round(time.Microsecond), s.MaxWait.Round(time.Microsecond))
+		total.Entries += s.Entries
+		total.Messages += s.Messages
+		total.TotalWait += s.TotalWait
+		total.MaxWait = max(total.MaxWait, s.MaxWait)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Printf("Mensajes por entrada: %.1f\n", total.MessagesPerEntry())
+	fmt.Println("Espera promedio:", total.AverageWait().Round(time.Microsecond))
+	return total
+}
+
+// printMutexComparison compara el costo por entrada de las estrategias
+// ejecutadas con el costo teórico de cada una
+func printMutexComparison(trials []mutexTrial, count int) {
+	fmt.Println()
+	fmt.Printf("Comparación con %d nodos\n\n", count)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "ESTRATEGIA\tMSJ/ENTRADA\tTEÓRICO\tESPERA PROM\tESPERA MÁX\tVIOLACIONES\t")
+	for _, t := range trials {
+		fmt.Fprintf(w, "%s\t%.1f\t%s\t%s\t%s\t%d\t\n", t.algo, t.total.MessagesPerEntry(), mutexCost(t.algo, count),
+			t.total.AverageWait().Round(time.Microsecond), t.total.MaxWait.Round(time.Microsecond), t.violaciones)
+	}
+	w.Flush()
+}
+
+// mutexCost retorna el costo teórico en mensajes por entrada de una estrategia
+func mutexCost(algo string, count int) string {
+	switch algo {
+	case "ricart":
+		// 2(N-1): REQUEST y REPLY con cada par
+		return strconv.Itoa(2 * (count - 1))
+	case "maekawa":
+		// Entre 3(K-1) y 5(K-1), con K el mayor conjunto de votación
+		addresses := make([]string, count)
+		for i := range addresses {
+			addresses[i] = strconv.Itoa(i)
+		}
+		k := 0
+		for _, address := range addresses {
+			k = max(k, len(sync.MaekawaQuorum(addresses, address)))
+		}
+		return fmt.Sprintf("%d-%d", 3*(k-1), 5*(k-1))
+	case "token":
+		// Un paso por entrada con carga alta, hasta N-1 con carga baja
+		return fmt.Sprintf("1-%d", count-1)
+	}
+	return "-"
+}
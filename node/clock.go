@@ -0,0 +1,140 @@
+package node
+
+import (
+	"time"
+)
+
+// TimeLayout es el formato de hora usado en los mensajes. Incluye microsegundos
+// para que los ajustes menores a un segundo no se pierdan en la red.
+const TimeLayout = "2006-01-02 15:04:05.000000"
+
+// FormatTime convierte una hora al formato de los mensajes
+func FormatTime(t time.Time) string {
+	return t.Format(TimeLayout)
+}
+
+// ParseTime interpreta una hora recibida en un mensaje. Acepta también el
+// formato anterior sin fracción de segundo.
+func ParseTime(s string) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04:05", s)
+}
+
+// RealNow retorna la hora real del instante actual según TimeSource. El reloj
+// local y las esperas con plazo se miden con ella.
+func (n *Node) RealNow() time.Time {
+	if n.TimeSource != nil {
+		return n.TimeSource()
+	}
+	return time.Now()
+}
+
+// GetClock obtiene el reloj actual del nodo (con protección de concurrencia).
+// El reloj avanza con el tiempo real desde el último ajuste, acelerado o
+// retrasado según la deriva configurada.
+func (n *Node) GetClock() time.Time {
+	n.Mutex.Lock()
+	defer n.Mutex.Unlock()
+	return n.clockAt(n.RealNow())
+}
+
+// SetClock ajusta el reloj del nodo (con protección de concurrencia). El
+// ajuste no trae cota de error, por lo que NowInterval deja de estar acotado
+// hasta la próxima llamada a SyncClock. Con MaxSlew la corrección se aplica
+// de forma gradual (ver adjustClock).
+func (n *Node) SetClock(t time.Time) {
+	n.Mutex.Lock()
+	n.adjustClock(n.RealNow(), t)
+	n.errorSet = time.Time{}
+	n.Mutex.Unlock()
+}
+
+// TargetClock retorna la hora a la que converge el reloj: la actual más la
+// corrección gradual pendiente. Es la hora que el nodo informa a los demás,
+// para que una corrección en curso no se propague como desfase.
+func (n *Node) TargetClock() time.Time {
+	now := n.RealNow()
+	n.Mutex.Lock()
+	defer n.Mutex.Unlock()
+	return n.clockAt(now).Add(n.pendingAt(now))
+}
+
+// PendingCorrection retorna la parte de la última corrección que todavía no
+// se aplica al reloj en modo gradual
+func (n *Node) PendingCorrection() time.Duration {
+	now := n.RealNow()
+	n.Mutex.Lock()
+	defer n.Mutex.Unlock()
+	return n.pendingAt(now)
+}
+
+// BackwardSlew es la tasa en ppm con que se frenan las correcciones hacia
+// atrás mayores a StepThreshold cuando no se permite saltar. A la tasa de
+// MaxSlew un reloj adelantado unos segundos tardaría horas en corregirse; a
+// esta el reloj avanza a la décima parte de su velocidad hasta corregirse.
+var BackwardSlew = 900000.0
+
+// adjustClock lleva el reloj a t en el instante real now. Sin MaxSlew salta
+// directamente (puede retroceder). Con MaxSlew la corrección se reparte
+// acelerando o frenando el reloj a esa tasa como máximo, por lo que el reloj
+// nunca retrocede; solo las correcciones mayores a StepThreshold saltan, y
+// hacia atrás únicamente con AllowBackwards (sin él se frenan a BackwardSlew).
+// Debe llamarse con Mutex tomado.
+func (n *Node) adjustClock(now, t time.Time) {
+	current := n.clockAt(now)
+	correction := t.Sub(current)
+	// Una corrección hacia atrás rápida que sigue en curso continúa a la misma
+	// tasa aunque lo que falte ya sea menor a StepThreshold
+	rapida := n.pendingAt(now) < 0 && n.slewRate > n.MaxSlew
+	n.clockSet = now
+	n.slew = 0
+
+	step := n.MaxSlew <= 0 ||
+		(n.StepThreshold > 0 && correction.Abs() > n.StepThreshold && (correction > 0 || n.AllowBackwards))
+	if step {
+		n.Clock = t
+		return
+	}
+
+	// La corrección reemplaza a la que estuviera pendiente, porque t ya es la
+	// hora buscada
+	n.Clock = current
+	n.slew = correction
+	n.slewRate = n.MaxSlew
+	if correction < 0 {
+		if rapida || (n.StepThreshold > 0 && -correction > n.StepThreshold) {
+			n.slewRate = max(n.slewRate, BackwardSlew)
+		}
+		// Frenar más que la velocidad del reloj lo haría retroceder
+		n.slewRate = min(n.slewRate, 1e6+n.Drift)
+	}
+}
+
+// clockAt calcula la hora local en el instante real indicado
+func (n *Node) clockAt(now time.Time) time.Time {
+	if n.clockSet.IsZero() {
+		return n.Clock
+	}
+	elapsed := now.Sub(n.clockSet)
+	return n.Clock.Add(elapsed + time.Duration(float64(elapsed)*n.Drift/1e6) + n.slewedAt(elapsed))
+}
+
+// slewedAt retorna la parte de la corrección gradual aplicada tras elapsed
+// desde el último ajuste
+func (n *Node) slewedAt(elapsed time.Duration) time.Duration {
+	if n.slew == 0 {
+		return 0
+	}
+	applied := time.Duration(float64(elapsed) * n.slewRate / 1e6)
+	if n.slew > 0 {
+		return min(applied, n.slew)
+	}
+	return max(-applied, n.slew)
+}
+
+// pendingAt retorna la corrección gradual que falta aplicar en el instante real indicado
+func (n *Node) pendingAt(now time.Time) time.Duration {
+	if n.slew == 0 {
+		return 0
+	}
+	return n.slew - n.slewedAt(now.Sub(n.clockSet))
+}
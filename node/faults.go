@@ -0,0 +1,459 @@
+package node
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrLinkDown se retorna al conectar dos nodos cuyo enlace está desconectado
+// o que están en grupos distintos de la partición actual
+var ErrLinkDown = errors.New("enlace desconectado por inyección de fallas")
+
+// LinkFaults son las fallas inyectadas en un sentido de la comunicación entre
+// dos nodos. Con latencias distintas en cada sentido se simula una red asimétrica.
+type LinkFaults struct {
+	Latency      Latency       // Latencia de un sentido (nil sin retardo adicional)
+	Loss         float64       // Probabilidad de perder el mensaje
+	Duplicate    float64       // Probabilidad de entregar el mensaje dos veces
+	Reorder      float64       // Probabilidad de retrasar el mensaje ReorderDelay adicional
+	ReorderDelay time.Duration // Retraso adicional de los mensajes reordenados
+	Disconnected bool          // El enlace rechaza las conexiones
+}
+
+// Faults guarda las fallas configuradas por cada par de nodos. Puede
+// compartirse entre varios nodos del mismo proceso.
+type Faults struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	defaults LinkFaults          // Fallas de los enlaces sin configuración propia
+	links    map[link]LinkFaults // Fallas por sentido de cada par
+
+	partitioned [][]string       // Grupos de la partición actual (nil sin partición)
+	groups      map[string]int   // Grupo de cada nodo en la partición actual
+	generation  uint64           // Se incrementa con cada partición aplicada
+	schedule    []PartitionEvent // Particiones programadas
+	dropped     []DroppedMessage // Últimos mensajes descartados
+}
+
+// link identifica un sentido de la comunicación entre dos nodos
+type link struct {
+	from, to string
+}
+
+// delivery es la decisión tomada para un mensaje
+type delivery struct {
+	drop      string // Motivo del descarte (vacío si se entrega)
+	duplicate bool
+	delay     time.Duration
+}
+
+// NewFaults crea una configuración de fallas vacía con el generador aleatorio
+// inicializado con la semilla
+func NewFaults(seed uint64) *Faults {
+	return &Faults{
+		rng:   rand.New(rand.NewPCG(seed, seed)),
+		links: make(map[link]LinkFaults),
+	}
+}
+
+// SetDefault define las fallas de los enlaces sin configuración propia
+func (f *Faults) SetDefault(lf LinkFaults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.defaults = lf
+}
+
+// SetLink define las fallas del sentido from -> to
+func (f *Faults) SetLink(from, to string, lf LinkFaults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.links[link{from, to}] = lf
+}
+
+// NamesNodes indica si la configuración menciona nodos por su dirección
+// (enlaces propios o particiones programadas)
+func (f *Faults) NamesNodes() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.links) > 0 || len(f.schedule) > 0
+}
+
+// Link retorna las fallas del sentido from -> to
+func (f *Faults) Link(from, to string) LinkFaults {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.link(from, to)
+}
+
+// Disconnect corta por completo la comunicación entre dos nodos
+func (f *Faults) Disconnect(a, b string) {
+	f.setDisconnected(a, b, true)
+}
+
+// Reconnect restablece la comunicación entre dos nodos
+func (f *Faults) Reconnect(a, b string) {
+	f.setDisconnected(a, b, false)
+}
+
+func (f *Faults) setDisconnected(a, b string, disconnected bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range []link{{a, b}, {b, a}} {
+		lf := f.link(l.from, l.to)
+		lf.Disconnected = disconnected
+		f.links[l] = lf
+	}
+}
+
+// link retorna las fallas de un sentido. Debe llamarse con mu tomado.
+func (f *Faults) link(from, to string) LinkFaults {
+	if lf, ok := f.links[link{from, to}]; ok {
+		return lf
+	}
+	return f.defaults
+}
+
+// connected indica si dos nodos pueden conectarse: el enlace no está
+// desconectado y la partición actual no los separa. Si no pueden, registra el
+// intento como un mensaje descartado (todavía sin tipo, porque la conexión se
+// rechaza antes de escribirlo). Los mensajes de conexiones abiertas antes de
+// la partición se descartan al escribirlos (ver decide).
+func (f *Faults) connected(from, to string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case f.link(from, to).Disconnected || f.link(to, from).Disconnected:
+		f.recordDrop(from, to, "", "desconectado")
+		return false
+	case f.separated(from, to):
+		f.recordDrop(from, to, "", "particion")
+		return false
+	}
+	return true
+}
+
+// decide sortea qué ocurre con un mensaje en el sentido from -> to y
+// registra el mensaje si se descarta
+func (f *Faults) decide(from, to, message string) delivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lf := f.link(from, to)
+	var d delivery
+	switch {
+	case lf.Disconnected:
+		d.drop = "desconectado"
+	case f.separated(from, to):
+		d.drop = "particion"
+	case f.rng.Float64() < lf.Loss:
+		d.drop = "perdida"
+	}
+	if d.drop != "" {
+		f.recordDrop(from, to, message, d.drop)
+		return d
+	}
+
+	d.duplicate = f.rng.Float64() < lf.Duplicate
+	if lf.Latency != nil {
+		d.delay = lf.Latency.Sample(f.rng)
+	}
+	if f.rng.Float64() < lf.Reorder {
+		d.delay += lf.ReorderDelay
+	}
+	return d
+}
+
+// FaultyTransport envuelve otro transporte e inyecta las fallas configuradas
+// en las conexiones salientes: latencia de ida y de vuelta, pérdida,
+// duplicación, reordenamiento y desconexión de enlaces
+type FaultyTransport struct {
+	Inner  Transport
+	Faults *Faults
+}
+
+// NewFaultyTransport crea un transporte con fallas sobre inner
+func NewFaultyTransport(inner Transport, faults *Faults) *FaultyTransport {
+	return &FaultyTransport{Inner: inner, Faults: faults}
+}
+
+func (t *FaultyTransport) Listen(address string) (net.Listener, error) {
+	return t.Inner.Listen(address)
+}
+
+func (t *FaultyTransport) Dial(from, to string) (net.Conn, error) {
+	if !t.Faults.connected(from, to) {
+		return nil, fmt.Errorf("%s -> %s: %w", from, to, ErrLinkDown)
+	}
+	conn, err := t.Inner.Dial(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyConn{Conn: conn, transport: t, from: from, to: to, done: make(chan struct{})}, nil
+}
+
+// faultyConn aplica las fallas a una conexión. Cada conexión lleva un mensaje
+// en cada sentido: el mensaje de ida se entrega en segundo plano después de su
+// latencia y la respuesta se retiene según la latencia de vuelta.
+type faultyConn struct {
+	net.Conn
+	transport *FaultyTransport
+	from, to  string
+
+	mu           sync.Mutex
+	readDeadline time.Time      // Plazo de lectura configurado por el llamador
+	replied      bool           // Ya se aplicaron las fallas a la respuesta
+	pending      sync.WaitGroup // Envíos retrasados todavía en tránsito
+	closeOnce    sync.Once
+	done         chan struct{} // Se cierra al llamar a Close
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	d := c.transport.Faults.decide(c.from, c.to, string(b))
+	if d.drop != "" {
+		return len(b), nil
+	}
+
+	// Sin retardo ni duplicación el mensaje se escribe directamente
+	if d.delay == 0 && !d.duplicate {
+		return c.Conn.Write(b)
+	}
+
+	data := append([]byte(nil), b...)
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+		time.Sleep(d.delay)
+		c.Conn.Write(data)
+		if d.duplicate {
+			c.duplicate(data)
+		}
+	}()
+	return len(b), nil
+}
+
+// duplicate entrega una copia del mensaje en una conexión aparte
+func (c *faultyConn) duplicate(data []byte) {
+	conn, err := c.transport.Inner.Dial(c.from, c.to)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write(data)
+}
+
+func (c *faultyConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	c.mu.Lock()
+	first := n > 0 && !c.replied
+	if first {
+		c.replied = true
+	}
+	c.mu.Unlock()
+	if !first {
+		return n, err
+	}
+
+	// Las respuestas se registran con el tipo RESPUESTA
+	d := c.transport.Faults.decide(c.to, c.from, "RESPUESTA")
+	if d.drop != "" {
+		// La respuesta se pierde: el llamador espera hasta su plazo
+		return 0, c.wait(-1)
+	}
+	if err := c.wait(d.delay); err != nil {
+		return 0, err
+	}
+	return n, err
+}
+
+// wait espera la latencia indicada (negativa espera indefinidamente) sin
+// pasar el plazo de lectura ni seguir después de cerrar la conexión
+func (c *faultyConn) wait(d time.Duration) error {
+	c.mu.Lock()
+	deadline := c.readDeadline
+	c.mu.Unlock()
+
+	expires := false
+	if !deadline.IsZero() && (d < 0 || time.Until(deadline) < d) {
+		d = max(time.Until(deadline), 0)
+		expires = true
+	}
+
+	var timer <-chan time.Time
+	if d >= 0 {
+		timer = time.After(d)
+	}
+	select {
+	case <-timer:
+	case <-c.done:
+		return net.ErrClosed
+	}
+	if expires {
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+func (c *faultyConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *faultyConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Close retorna de inmediato; la conexión real se cierra cuando se hayan
+// entregado los mensajes en tránsito
+func (c *faultyConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		go func() {
+			c.pending.Wait()
+			c.Conn.Close()
+		}()
+	})
+	return nil
+}
+
+// ConnectionState expone el estado TLS de la conexión envuelta (vacío sin TLS)
+func (c *faultyConn) ConnectionState() tls.ConnectionState {
+	if tc, ok := c.Conn.(tlsConn); ok {
+		return tc.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
+
+// faultsFile es el formato del archivo de configuración de fallas
+type faultsFile struct {
+	Seed       uint64            `json:"seed"`
+	Default    faultsLink        `json:"default"`
+	Links      []faultsLink      `json:"links"`
+	Partitions []faultsPartition `json:"partitions"`
+}
+
+// faultsPartition es una partición programada en el archivo de configuración
+type faultsPartition struct {
+	Groups string `json:"groups"` // Grupos con la forma "8000 | 8001,8002"
+	From   string `json:"from"`   // Inicio de la partición, ej: "10s"
+	Until  string `json:"until"`  // Curación de la partición (vacío no la cura)
+}
+
+// faultsLink son las fallas de un enlace en el archivo de configuración
+type faultsLink struct {
+	From         string  `json:"from"`
+	To           string  `json:"to"`
+	Both         bool    `json:"both"` // Aplicar también en el sentido to -> from
+	Latency      string  `json:"latency"`
+	Loss         float64 `json:"loss"`
+	Duplicate    float64 `json:"duplicate"`
+	Reorder      float64 `json:"reorder"`
+	ReorderDelay string  `json:"reorder_delay"`
+	Disconnected bool    `json:"disconnected"`
+}
+
+// LoadFaults lee la configuración de fallas desde un archivo JSON, por ejemplo:
+//
+//	{"seed": 1, "default": {"latency": "uniform:1ms,5ms"},
+//	 "links": [{"from": "localhost:8000", "to": "localhost:8001", "latency": "fixed:80ms", "loss": 0.1}],
+//	 "partitions": [{"groups": "8000 | 8001,8002", "from": "10s", "until": "40s"}]}
+//
+// Las particiones se aplican al llamar a StartSchedule.
+func LoadFaults(path string) (*Faults, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file faultsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	faults := NewFaults(file.Seed)
+	defaults, err := file.Default.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%s: default: %w", path, err)
+	}
+	faults.SetDefault(defaults)
+
+	for i, l := range file.Links {
+		if l.From == "" || l.To == "" {
+			return nil, fmt.Errorf("%s: enlace %d sin from o to", path, i)
+		}
+		lf, err := l.parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s: enlace %s -> %s: %w", path, l.From, l.To, err)
+		}
+		faults.SetLink(l.From, l.To, lf)
+		if l.Both {
+			faults.SetLink(l.To, l.From, lf)
+		}
+	}
+
+	for i, p := range file.Partitions {
+		event, err := p.parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s: partición %d: %w", path, i, err)
+		}
+		faults.SchedulePartition(event)
+	}
+	return faults, nil
+}
+
+// parse convierte un enlace del archivo en LinkFaults
+func (l faultsLink) parse() (LinkFaults, error) {
+	lf := LinkFaults{
+		Loss:         l.Loss,
+		Duplicate:    l.Duplicate,
+		Reorder:      l.Reorder,
+		Disconnected: l.Disconnected,
+	}
+	if l.Latency != "" {
+		latency, err := ParseLatency(l.Latency)
+		if err != nil {
+			return lf, err
+		}
+		lf.Latency = latency
+	}
+	if l.ReorderDelay != "" {
+		delay, err := time.ParseDuration(l.ReorderDelay)
+		if err != nil {
+			return lf, fmt.Errorf("reorder_delay inválido: %w", err)
+		}
+		lf.ReorderDelay = delay
+	}
+	return lf, nil
+}
+
+// parse convierte una partición del archivo en PartitionEvent
+func (p faultsPartition) parse() (PartitionEvent, error) {
+	groups, err := ParsePartition(p.Groups)
+	if err != nil {
+		return PartitionEvent{}, err
+	}
+	event := PartitionEvent{Groups: groups}
+	if p.From != "" {
+		if event.From, err = time.ParseDuration(p.From); err != nil {
+			return event, fmt.Errorf("from inválido: %w", err)
+		}
+	}
+	if p.Until != "" {
+		if event.Until, err = time.ParseDuration(p.Until); err != nil {
+			return event, fmt.Errorf("until inválido: %w", err)
+		}
+	}
+	return event, nil
+}
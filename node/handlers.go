@@ -0,0 +1,59 @@
+package node
+
+import (
+	"net"
+	"strings"
+)
+
+// MessageHandler procesa un mensaje recibido. conn permite responder al remitente.
+type MessageHandler func(message string, conn net.Conn)
+
+// RegisterHandler asocia un manejador a los mensajes que comienzan con prefix.
+// Permite que los algoritmos de otros paquetes reciban sus propios mensajes.
+func (n *Node) RegisterHandler(prefix string, handler MessageHandler) {
+	n.handlersMu.Lock()
+	defer n.handlersMu.Unlock()
+	if n.handlers == nil {
+		n.handlers = make(map[string]MessageHandler)
+	}
+	n.handlers[prefix] = handler
+}
+
+// UnregisterHandler elimina el manejador asociado a prefix
+func (n *Node) UnregisterHandler(prefix string) {
+	n.handlersMu.Lock()
+	defer n.handlersMu.Unlock()
+	delete(n.handlers, prefix)
+}
+
+// dispatch entrega el mensaje al manejador registrado con el prefijo más largo.
+// Retorna false si ningún manejador lo acepta.
+func (n *Node) dispatch(message string, conn net.Conn) bool {
+	n.handlersMu.RLock()
+	var best string
+	var handler MessageHandler
+	for prefix, h := range n.handlers {
+		if strings.HasPrefix(message, prefix) && len(prefix) >= len(best) {
+			best, handler = prefix, h
+		}
+	}
+	n.handlersMu.RUnlock()
+
+	if handler == nil {
+		return false
+	}
+	handler(message, conn)
+	return true
+}
+
+// hasHandler indica si hay un manejador registrado para el tipo de mensaje
+func (n *Node) hasHandler(msgType string) bool {
+	n.handlersMu.RLock()
+	defer n.handlersMu.RUnlock()
+	for prefix := range n.handlers {
+		if strings.TrimSuffix(prefix, ":") == msgType {
+			return true
+		}
+	}
+	return false
+}
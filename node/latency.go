@@ -0,0 +1,83 @@
+package node
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Latency es una distribución de la latencia de un mensaje en la red
+type Latency interface {
+	Sample(r *rand.Rand) time.Duration
+	String() string
+}
+
+// Fixed es una latencia constante
+type Fixed time.Duration
+
+func (f Fixed) Sample(*rand.Rand) time.Duration { return time.Duration(f) }
+func (f Fixed) String() string                  { return "fixed:" + time.Duration(f).String() }
+
+// Uniform es una latencia con distribución uniforme entre Min y Max
+type Uniform struct {
+	Min, Max time.Duration
+}
+
+func (u Uniform) Sample(r *rand.Rand) time.Duration {
+	if u.Max <= u.Min {
+		return u.Min
+	}
+	return u.Min + time.Duration(r.Int64N(int64(u.Max-u.Min)))
+}
+
+func (u Uniform) String() string { return fmt.Sprintf("uniform:%s,%s", u.Min, u.Max) }
+
+// Normal es una latencia con distribución normal truncada en cero
+type Normal struct {
+	Mean, StdDev time.Duration
+}
+
+func (n Normal) Sample(r *rand.Rand) time.Duration {
+	return max(0, n.Mean+time.Duration(r.NormFloat64()*float64(n.StdDev)))
+}
+
+func (n Normal) String() string { return fmt.Sprintf("normal:%s,%s", n.Mean, n.StdDev) }
+
+// Exponential es una latencia mínima más una cola exponencial de media Mean
+type Exponential struct {
+	Min, Mean time.Duration
+}
+
+func (e Exponential) Sample(r *rand.Rand) time.Duration {
+	return e.Min + time.Duration(r.ExpFloat64()*float64(e.Mean))
+}
+
+func (e Exponential) String() string { return fmt.Sprintf("exp:%s,%s", e.Min, e.Mean) }
+
+// ParseLatency interpreta una distribución de latencia con la forma
+// "fixed:5ms", "uniform:1ms,20ms", "normal:10ms,3ms" o "exp:1ms,5ms"
+func ParseLatency(spec string) (Latency, error) {
+	kind, args, _ := strings.Cut(spec, ":")
+	values := strings.Split(args, ",")
+	durations := make([]time.Duration, len(values))
+	for i, v := range values {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("latencia inválida %q: %w", spec, err)
+		}
+		durations[i] = d
+	}
+
+	switch {
+	case kind == "fixed" && len(durations) == 1:
+		return Fixed(durations[0]), nil
+	case kind == "uniform" && len(durations) == 2:
+		return Uniform{Min: durations[0], Max: durations[1]}, nil
+	case kind == "normal" && len(durations) == 2:
+		return Normal{Mean: durations[0], StdDev: durations[1]}, nil
+	case kind == "exp" && len(durations) == 2:
+		return Exponential{Min: durations[0], Mean: durations[1]}, nil
+	}
+	return nil, fmt.Errorf("latencia inválida %q (use fixed:d, uniform:min,max, normal:media,desv o exp:min,media)", spec)
+}
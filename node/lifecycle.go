@@ -0,0 +1,141 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Start abre el socket de escucha de forma sincrónica y atiende las conexiones
+// en segundo plano. Un error al abrir el puerto se retorna al llamador.
+// Si la dirección usa el puerto 0 se elige uno libre y Address se actualiza
+// con el puerto asignado. El listener se cierra cuando se cancela ctx.
+func (n *Node) Start(ctx context.Context) error {
+	ln, err := n.listen()
+	if err != nil {
+		return fmt.Errorf("no se pudo escuchar en %s: %w", n.Address, err)
+	}
+
+	// Conservar el host configurado y reportar el puerto realmente asignado
+	if host, port, err := net.SplitHostPort(n.Address); err == nil && port == "0" {
+		_, actual, _ := net.SplitHostPort(ln.Addr().String())
+		n.Address = net.JoinHostPort(host, actual)
+	}
+
+	n.lnMu.Lock()
+	n.listener = ln
+	n.lnMu.Unlock()
+	n.running.Store(true)
+
+	n.Logger.Info("escuchando", "address", n.Address)
+
+	go n.acceptLoop(ln)
+	go func() {
+		<-ctx.Done()
+		n.Stop()
+	}()
+	return nil
+}
+
+// acceptLoop atiende conexiones entrantes hasta que se cierre el listener.
+// Ante errores como EMFILE espera antes de reintentar, duplicando la espera
+// hasta un segundo, igual que net/http.Server.
+func (n *Node) acceptLoop(ln net.Listener) {
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else {
+				delay = min(2*delay, time.Second)
+			}
+			n.Logger.Warn("error aceptando conexión", "error", err, "retry", delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		if !n.track(conn) {
+			conn.Close()
+			continue
+		}
+		go n.handleConnection(conn)
+	}
+}
+
+// IsRunning indica si el nodo está aceptando conexiones
+func (n *Node) IsRunning() bool {
+	return n.running.Load()
+}
+
+// Stop detiene el nodo (cierra el servidor) sin esperar las conexiones en curso
+func (n *Node) Stop() {
+	n.closeListener()
+}
+
+// Shutdown cierra el listener y espera que terminen las conexiones en curso.
+// Si el contexto vence antes, cierra a la fuerza las conexiones restantes.
+func (n *Node) Shutdown(ctx context.Context) error {
+	n.closeListener()
+
+	done := make(chan struct{})
+	go func() {
+		n.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		n.Logger.Info("nodo detenido")
+		return nil
+	case <-ctx.Done():
+		n.lnMu.Lock()
+		pending := len(n.active)
+		for conn := range n.active {
+			conn.Close()
+		}
+		n.lnMu.Unlock()
+		n.Logger.Warn("conexiones cerradas a la fuerza al detener el nodo", "pending", pending)
+		return ctx.Err()
+	}
+}
+
+// closeListener deja de aceptar conexiones nuevas
+func (n *Node) closeListener() {
+	n.running.Store(false)
+
+	n.lnMu.Lock()
+	defer n.lnMu.Unlock()
+	if n.listener != nil {
+		n.listener.Close()
+		n.listener = nil
+	}
+}
+
+// track registra una conexión entrante. Retorna false si el nodo se está deteniendo.
+func (n *Node) track(conn net.Conn) bool {
+	n.lnMu.Lock()
+	defer n.lnMu.Unlock()
+	if !n.running.Load() {
+		return false
+	}
+	if n.active == nil {
+		n.active = make(map[net.Conn]struct{})
+	}
+	n.active[conn] = struct{}{}
+	n.inFlight.Add(1)
+	return true
+}
+
+// untrack marca una conexión entrante como terminada
+func (n *Node) untrack(conn net.Conn) {
+	n.lnMu.Lock()
+	delete(n.active, conn)
+	n.lnMu.Unlock()
+	n.inFlight.Done()
+}
@@ -0,0 +1,33 @@
+package node
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoLocker indica que el nodo no tiene una estrategia de exclusión mutua
+var ErrNoLocker = errors.New("el nodo no tiene exclusión mutua distribuida configurada")
+
+// Locker es una estrategia de exclusión mutua distribuida entre los nodos
+type Locker interface {
+	// Lock espera hasta obtener la sección crítica o hasta que se cancele ctx
+	Lock(ctx context.Context) error
+	// Unlock libera la sección crítica
+	Unlock() error
+}
+
+// Lock obtiene la sección crítica distribuida con la estrategia del nodo
+func (n *Node) Lock(ctx context.Context) error {
+	if n.Locker == nil {
+		return ErrNoLocker
+	}
+	return n.Locker.Lock(ctx)
+}
+
+// Unlock libera la sección crítica distribuida
+func (n *Node) Unlock() error {
+	if n.Locker == nil {
+		return ErrNoLocker
+	}
+	return n.Locker.Unlock()
+}
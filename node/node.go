@@ -2,12 +2,19 @@ package node
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
-	"os"
+	"slices"
+	"solemne3_SO/metrics"
+	"solemne3_SO/utils"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -31,56 +38,83 @@ import (
 //     return
 // }
 
+// RequestTimeout es el tiempo máximo de espera de una respuesta en Request
+const RequestTimeout = 5 * time.Second
+
 // Node representa un nodo dentro del sistema distribuido
 type Node struct {
-	Name      string     // Nombre del nodo
-	Address   string     // Dirección IP:Puerto
-	Clock     time.Time  // Reloj local del nodo
-	Peers     []string   // Lista de direcciones de otros nodos
-	Mutex     sync.Mutex // Para acceso concurrente seguro al reloj
-	IsRunning bool       // Estado del nodo
+	Name           string                // Nombre del nodo
+	Address        string                // Dirección IP:Puerto
+	Clock          time.Time             // Reloj local del nodo en el último ajuste
+	Drift          float64               // Deriva del reloj en partes por millón (ppm)
+	MaxDrift       float64               // Deriva máxima supuesta en ppm para acotar el error (0 usa DefaultMaxDrift)
+	MaxSlew        float64               // Tasa máxima de ajuste gradual en ppm (0 salta siempre)
+	StepThreshold  time.Duration         // Con MaxSlew, corrección a partir de la cual se salta (0 nunca salta)
+	AllowBackwards bool                  // Con MaxSlew, permite saltos hacia atrás mayores a StepThreshold
+	Peers          []string              // Lista de direcciones de otros nodos
+	Mutex          sync.Mutex            // Para acceso concurrente seguro al reloj
+	TLSConfig      *tls.Config           // Configuración TLS mutua (nil usa TCP sin cifrar)
+	Transport      Transport             // Transporte de red (nil usa TCP con TLSConfig)
+	Sessions       *utils.SessionManager // Claves de sesión por par (nil las deshabilita)
+	Locker         Locker                // Exclusión mutua distribuida (nil la deshabilita)
+	Logger         *slog.Logger          // Logger con el atributo del nodo
+	TimeSource     func() time.Time      // Fuente de la hora real (nil usa time.Now; el simulador usa tiempo virtual)
+
+	clockSet   time.Time     // Instante real del último ajuste del reloj
+	errorBound time.Duration // Cota de error de la última sincronización
+	errorSet   time.Time     // Instante real de la última sincronización con cota (cero si no hay)
+	slew       time.Duration // Corrección gradual iniciada en el último ajuste
+	slewRate   float64       // Tasa en ppm de la corrección gradual en curso
+
+	statusMu sync.Mutex            // Protege el historial de ajustes y la salud de los pares
+	offsets  []OffsetRecord        // Últimos ajustes aplicados al reloj
+	adjusted int                   // Total de ajustes registrados desde el inicio
+	health   map[string]PeerStatus // Estado de la comunicación con cada par
+
+	handlersMu sync.RWMutex              // Protege los manejadores registrados
+	handlers   map[string]MessageHandler // Manejadores por prefijo de mensaje
+
+	observersMu  sync.RWMutex            // Protege los observadores de mensajes
+	observers    map[int]MessageObserver // Observadores de los mensajes entrantes
+	nextObserver int                     // Identificador del próximo observador
+	tagSender    atomic.Bool             // Indicar el remitente en los mensajes salientes
+	sentMu       sync.Mutex              // Protege las secuencias de los canales salientes
+	sent         map[string]uint64       // Mensajes enviados con remitente a cada par
+
+	running  atomic.Bool           // Indica si el listener acepta conexiones
+	lnMu     sync.Mutex            // Protege el listener y las conexiones activas
+	listener net.Listener          // Socket de escucha (nil si no se inició)
+	active   map[net.Conn]struct{} // Conexiones entrantes en curso
+	inFlight sync.WaitGroup        // Conexiones entrantes pendientes de terminar
 }
 
 // NewNode crea una nueva instancia de nodo
 func NewNode(name, address string, peers []string) *Node {
+	now := time.Now()
 	return &Node{
-		Name:      name,
-		Address:   address,
-		Clock:     time.Now().UTC(),
-		Peers:     peers,
-		IsRunning: true,
-	}
-}
-
-// StartListener inicia un servidor TCP que escucha mensajes entrantes
-func (n *Node) StartListener() {
-	ln, err := net.Listen("tcp", n.Address)
-	if err != nil {
-		fmt.Println("Error iniciando listener:", err)
-		os.Exit(1)
-	}
-	defer ln.Close()
-
-	fmt.Println("["+n.Name+"] escuchando en", n.Address)
-
-	for n.IsRunning {
-		conn, err := ln.Accept()
-		if err != nil {
-			fmt.Println("Error aceptando conexión:", err)
-			continue
-		}
-		go n.handleConnection(conn)
+		Name:     name,
+		Address:  address,
+		Clock:    now.UTC(),
+		Peers:    peers,
+		Logger:   slog.Default().With("node", name),
+		clockSet: now,
 	}
 }
 
 // handleConnection procesa cada conexión entrante
 func (n *Node) handleConnection(conn net.Conn) {
+	defer n.untrack(conn)
 	defer conn.Close()
 
 	reader := bufio.NewReader(conn)
 	message, err := reader.ReadString('\n')
+	if errors.Is(err, io.EOF) && message == "" {
+		// Conexión cerrada sin enviar nada (por ejemplo, un mensaje perdido)
+		n.Logger.Debug("conexión cerrada sin mensaje", "remote", conn.RemoteAddr().String())
+		return
+	}
 	if err != nil {
-		fmt.Println("["+n.Name+"] Error leyendo mensaje:", err)
+		n.Logger.Warn("error leyendo mensaje", "remote", conn.RemoteAddr().String(), "error", err)
 		return
 	}
 
@@ -90,16 +124,39 @@ func (n *Node) handleConnection(conn net.Conn) {
 
 // HandleMessage interpreta y responde a un mensaje recibido
 func (n *Node) HandleMessage(message string, conn net.Conn) {
-	fmt.Println("["+n.Name+"] Mensaje recibido:", message)
+	from, seq, message := splitSender(message)
+	n.handleFrom(from, seq, message, conn)
+}
+
+// handleFrom procesa un mensaje cuyo remitente ya se conoce. Los mensajes
+// cifrados se entregan a los observadores después de descifrarlos.
+func (n *Node) handleFrom(from string, seq uint64, message string, conn net.Conn) {
+	n.Logger.Debug("mensaje recibido", "type", MessageType(message), "message", message)
+	metrics.MessagesTotal.Inc(n.Name, "received", n.metricType(message))
+
+	if strings.HasPrefix(message, "ENC:") {
+		n.handleEncrypted(message, seq, conn)
+		return
+	}
+
+	n.observe(from, seq, message, func() {
+		n.process(message, conn)
+	})
+}
+
+// process atiende un mensaje en claro después de entregarlo a los observadores
+func (n *Node) process(message string, conn net.Conn) {
+	if strings.HasPrefix(message, "KEY_EXCHANGE:") {
+		n.handleKeyExchange(message, conn)
+		return
+	}
 
 	if strings.HasPrefix(message, "SETCLOCK:") {
 		newTimeStr := strings.TrimPrefix(message, "SETCLOCK:")
-		newTime, err := time.Parse("2006-01-02 15:04:05", newTimeStr)
+		newTime, err := ParseTime(newTimeStr)
 		if err == nil {
-			n.Mutex.Lock()
-			n.Clock = newTime
-			n.Mutex.Unlock()
-			fmt.Println("["+n.Name+"] Reloj ajustado a", newTime)
+			n.SetClock(newTime)
+			n.Logger.Info("reloj ajustado", "clock", newTime)
 		}
 	}
 
@@ -112,53 +169,119 @@ func (n *Node) HandleMessage(message string, conn net.Conn) {
 		n.HandleBerkeleyMessage(message, conn)
 		return
 	}
+
+	if !n.dispatch(message, conn) && !strings.HasPrefix(message, "SETCLOCK:") {
+		n.Logger.Debug("mensaje sin manejador", "type", MessageType(message))
+	}
+}
+
+// listen abre el socket de escucha del nodo con su transporte
+func (n *Node) listen() (net.Listener, error) {
+	return n.transport().Listen(n.Address)
 }
 
-// SendMessage envía un mensaje a un nodo remoto
-func (n *Node) SendMessage(toAddress, message string) {
-	conn, err := net.Dial("tcp", toAddress)
+// Dial abre una conexión hacia otro nodo con el transporte del nodo
+// y registra el resultado en la salud del par
+func (n *Node) Dial(toAddress string) (net.Conn, error) {
+	conn, err := n.transport().Dial(n.Address, toAddress)
+	n.markPeer(toAddress, err)
+	return conn, err
+}
+
+// SendMessage envía un mensaje a un nodo remoto, cifrado con la clave de
+// sesión del par si el nodo tiene claves de sesión
+func (n *Node) SendMessage(toAddress, message string) error {
+	message, err := n.seal(toAddress, message)
 	if err != nil {
-		fmt.Println("["+n.Name+"] No se pudo conectar a", toAddress, "-", err)
-		return
+		n.Logger.Warn("no se pudo cifrar el mensaje", "peer", toAddress, "error", err)
+		return err
+	}
+
+	conn, err := n.Dial(toAddress)
+	if err != nil {
+		n.Logger.Warn("no se pudo conectar", "peer", toAddress, "error", err)
+		return err
 	}
 	defer conn.Close()
 
-	_, err = fmt.Fprintf(conn, message+"\n")
+	_, err = fmt.Fprint(conn, n.withSender(toAddress, message)+"\n")
 	if err != nil {
-		fmt.Println("["+n.Name+"] Error enviando mensaje a", toAddress, "-", err)
+		n.Logger.Warn("error enviando mensaje", "peer", toAddress, "error", err)
+		return err
 	}
+
+	metrics.MessagesTotal.Inc(n.Name, "sent", n.metricType(message))
+	return nil
 }
 
-// BroadcastMessage envía un mensaje a todos los nodos conectados
-func (n *Node) BroadcastMessage(message string) {
-	for _, peer := range n.Peers {
-		go n.SendMessage(peer, message)
+// Request envía un mensaje a un nodo remoto y espera una línea de respuesta
+func (n *Node) Request(toAddress, message string) (string, error) {
+	reply, _, err := n.request(toAddress, message)
+	return reply, err
+}
+
+// request envía un mensaje, espera una línea de respuesta y retorna también
+// la identidad del nodo que respondió según su certificado TLS ("" sin TLS)
+func (n *Node) request(toAddress, message string) (string, string, error) {
+	message, err := n.seal(toAddress, message)
+	if err != nil {
+		return "", "", err
 	}
+
+	conn, err := n.Dial(toAddress)
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(n.RealNow().Add(RequestTimeout))
+
+	if _, err := fmt.Fprint(conn, n.withSender(toAddress, message)+"\n"); err != nil {
+		return "", "", err
+	}
+	metrics.MessagesTotal.Inc(n.Name, "sent", n.metricType(message))
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", "", err
+	}
+	identity, _ := PeerIdentity(conn)
+	return strings.TrimSpace(reply), identity, nil
 }
 
-// Stop detiene el nodo (cierra el servidor)
-func (n *Node) Stop() {
-	n.IsRunning = false
+// MessageType obtiene el tipo de un mensaje (el texto antes del primer ':'),
+// sin contar la indicación del remitente
+func MessageType(message string) string {
+	_, _, message = splitSender(message)
+	msgType, _, _ := strings.Cut(message, ":")
+	return msgType
 }
 
-// GetClock obtiene el reloj actual del nodo (con protección de concurrencia)
-func (n *Node) GetClock() time.Time {
-	n.Mutex.Lock()
-	defer n.Mutex.Unlock()
-	return n.Clock
+// builtinTypes son los tipos de mensaje que el nodo atiende sin manejadores registrados
+var builtinTypes = []string{"KEY_EXCHANGE", "ENC", "SETCLOCK", "TIME_REQUEST", "GET_TIME", "ADJUST_TIME"}
+
+// metricType retorna el tipo de un mensaje para las métricas. Solo se usan
+// los tipos conocidos (integrados o con manejador registrado) y "other" para
+// el resto, para que un cliente no pueda crear series sin límite.
+func (n *Node) metricType(message string) string {
+	msgType := MessageType(message)
+	if slices.Contains(builtinTypes, msgType) || n.hasHandler(msgType) {
+		return msgType
+	}
+	return "other"
 }
 
-// SetClock ajusta el reloj del nodo (con protección de concurrencia)
-func (n *Node) SetClock(t time.Time) {
-	n.Mutex.Lock()
-	n.Clock = t
-	n.Mutex.Unlock()
+// BroadcastMessage envía un mensaje a todos los nodos conectados
+func (n *Node) BroadcastMessage(message string) {
+	for _, peer := range n.Peers {
+		go n.SendMessage(peer, message)
+	}
 }
 
 func (n *Node) HandleTimeRequest(conn net.Conn) {
-	currentTime := n.GetClock().Format("2006-01-02 15:04:05")
-	conn.Write([]byte(currentTime + "\n"))
-	fmt.Println("["+n.Name+"] Hora enviada a cliente:", currentTime)
+	reply := n.TimeReply()
+	conn.Write([]byte(reply + "\n"))
+	n.Logger.Debug("hora enviada a cliente", "clock", reply)
 }
 
 func (n *Node) HandleBerkeleyMessage(message string, conn net.Conn) {
@@ -166,21 +289,25 @@ func (n *Node) HandleBerkeleyMessage(message string, conn net.Conn) {
 
 	switch {
 	case msg == "GET_TIME":
-		currentTime := n.GetClock().Format("2006-01-02 15:04:05")
+		currentTime := FormatTime(n.TargetClock())
 		conn.Write([]byte(currentTime + "\n"))
-		fmt.Println("["+n.Name+"] Enviando hora:", currentTime)
+		n.Logger.Debug("enviando hora", "algorithm", "berkeley", "clock", currentTime)
 
 	case strings.HasPrefix(msg, "ADJUST_TIME:"):
 		parts := strings.Split(msg, ":")
 		if len(parts) != 2 {
 			return
 		}
-		adjustmentSec, err := strconv.ParseInt(parts[1], 10, 64)
+		adjustmentSec, err := strconv.ParseFloat(parts[1], 64)
 		if err != nil {
 			return
 		}
-		newTime := n.GetClock().Add(time.Duration(adjustmentSec) * time.Second)
+		adjustment := time.Duration(adjustmentSec * float64(time.Second))
+		newTime := n.TargetClock().Add(adjustment)
 		n.SetClock(newTime)
-		fmt.Println("["+n.Name+"] Reloj ajustado a", newTime)
+		n.RecordOffset("coordinador", "berkeley", adjustment)
+		metrics.ObserveAdjustment(n.Name, "berkeley", adjustment)
+		n.Logger.Info("reloj ajustado por el coordinador", "algorithm", "berkeley",
+			"offset", adjustment, "clock", newTime)
 	}
 }
@@ -0,0 +1,93 @@
+package node
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// viaPrefix antecede a los mensajes que indican el nodo remitente:
+// "VIA:<dirección>#<secuencia> <mensaje>"
+const viaPrefix = "VIA:"
+
+// MessageObserver recibe cada mensaje entrante junto con la dirección del
+// nodo que lo envió (vacía si el remitente no se identificó) y su número de
+// secuencia en el canal entre ambos (cero si no lo indica). El observador
+// debe llamar a handle una vez para que el nodo procese el mensaje, lo que le
+// permite retrasarlo o procesarlo dentro de una sección crítica propia.
+type MessageObserver func(from string, seq uint64, message string, handle func())
+
+// ObserveMessages registra un observador de los mensajes entrantes. Mientras
+// haya observadores los mensajes salientes del nodo indican su remitente y
+// un número de secuencia por destinatario, de modo que los demás nodos puedan
+// asociarlos a un canal y ordenarlos. Retorna una función que elimina el
+// observador.
+func (n *Node) ObserveMessages(observer MessageObserver) (remove func()) {
+	n.observersMu.Lock()
+	defer n.observersMu.Unlock()
+	if n.observers == nil {
+		n.observers = make(map[int]MessageObserver)
+	}
+	id := n.nextObserver
+	n.nextObserver++
+	n.observers[id] = observer
+	n.tagSender.Store(true)
+
+	return func() {
+		n.observersMu.Lock()
+		defer n.observersMu.Unlock()
+		delete(n.observers, id)
+		n.tagSender.Store(len(n.observers) > 0)
+	}
+}
+
+// observe entrega un mensaje entrante a los observadores, en el orden en que
+// se registraron, y lo procesa con handle a través del último
+func (n *Node) observe(from string, seq uint64, message string, handle func()) {
+	n.observersMu.RLock()
+	observers := make([]MessageObserver, 0, len(n.observers))
+	for _, id := range slices.Sorted(maps.Keys(n.observers)) {
+		observers = append(observers, n.observers[id])
+	}
+	n.observersMu.RUnlock()
+
+	for _, observer := range slices.Backward(observers) {
+		next := handle
+		handle = func() { observer(from, seq, message, next) }
+	}
+	handle()
+}
+
+// withSender agrega el remitente y la secuencia del canal hacia to a un
+// mensaje saliente si hay observadores
+func (n *Node) withSender(to, message string) string {
+	if !n.tagSender.Load() {
+		return message
+	}
+
+	n.sentMu.Lock()
+	if n.sent == nil {
+		n.sent = make(map[string]uint64)
+	}
+	n.sent[to]++
+	seq := n.sent[to]
+	n.sentMu.Unlock()
+
+	return viaPrefix + n.Address + "#" + strconv.FormatUint(seq, 10) + " " + message
+}
+
+// splitSender separa el remitente y la secuencia de un mensaje entrante, si
+// los indica
+func splitSender(message string) (from string, seq uint64, rest string) {
+	rest, ok := strings.CutPrefix(message, viaPrefix)
+	if !ok {
+		return "", 0, message
+	}
+	from, rest, _ = strings.Cut(rest, " ")
+	if address, number, ok := strings.Cut(from, "#"); ok {
+		from = address
+		seq, _ = strconv.ParseUint(number, 10, 64)
+	}
+	return from, seq, rest
+}
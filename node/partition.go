@@ -0,0 +1,204 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxDropped es la cantidad máxima de mensajes descartados que se conservan
+const maxDropped = 1000
+
+// DroppedMessage es un mensaje descartado por la inyección de fallas
+type DroppedMessage struct {
+	At     time.Time `json:"at"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Type   string    `json:"type,omitempty"` // Vacío si se rechazó la conexión
+	Reason string    `json:"reason"`         // perdida, particion o desconectado
+}
+
+// PartitionEvent es una partición programada. Los nodos de grupos distintos
+// no pueden comunicarse entre From y Until (medidos desde el inicio del
+// escenario); con Until en cero la partición no se cura sola.
+type PartitionEvent struct {
+	Groups [][]string
+	From   time.Duration
+	Until  time.Duration
+}
+
+// Partition separa los nodos en grupos. Dos nodos quedan incomunicados si
+// ambos aparecen en la partición y en grupos distintos; los nodos que no
+// aparecen siguen comunicándose con todos. Solo afecta los mensajes enviados
+// por los transportes que usan estas fallas: los nodos de un clúster que
+// comparten Faults quedan aislados en ambos sentidos, pero en nodos separados
+// cada uno debe aplicar la partición.
+func (f *Faults) Partition(groups ...[]string) {
+	f.partition(groups)
+}
+
+// PartitionFor aplica una partición y la cura después de d, salvo que antes
+// se haya reemplazado por otra
+func (f *Faults) PartitionFor(d time.Duration, groups ...[]string) {
+	generation := f.partition(groups)
+	time.AfterFunc(d, func() { f.heal(generation) })
+}
+
+// Heal elimina la partición actual
+func (f *Faults) Heal() {
+	f.heal(0)
+}
+
+// partition aplica una partición y retorna su generación
+func (f *Faults) partition(groups [][]string) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, address := range group {
+			f.groups[address] = i
+		}
+	}
+	f.partitioned = groups
+	f.generation++
+	slog.Warn("partición de red aplicada", "groups", FormatPartition(groups))
+	return f.generation
+}
+
+// heal cura la partición si sigue siendo la de la generación indicada
+// (0 cura cualquier partición)
+func (f *Faults) heal(generation uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.partitioned == nil || (generation != 0 && generation != f.generation) {
+		return
+	}
+	slog.Warn("partición de red curada", "groups", FormatPartition(f.partitioned))
+	f.groups = nil
+	f.partitioned = nil
+}
+
+// CurrentPartition retorna los grupos de la partición actual (nil si no hay)
+func (f *Faults) CurrentPartition() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.partitioned)
+}
+
+// Dropped retorna los últimos mensajes descartados, del más antiguo al más reciente
+func (f *Faults) Dropped() []DroppedMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]DroppedMessage{}, f.dropped...)
+}
+
+// SchedulePartition programa una partición y su curación
+func (f *Faults) SchedulePartition(p PartitionEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schedule = append(f.schedule, p)
+}
+
+// StartSchedule aplica las particiones programadas contando el tiempo desde
+// ahora, hasta que se cancele el contexto
+func (f *Faults) StartSchedule(ctx context.Context) {
+	f.mu.Lock()
+	schedule := slices.Clone(f.schedule)
+	f.mu.Unlock()
+
+	for _, p := range schedule {
+		go func() {
+			if !sleepContext(ctx, p.From) {
+				return
+			}
+			generation := f.partition(p.Groups)
+			if p.Until <= p.From || !sleepContext(ctx, p.Until-p.From) {
+				return
+			}
+			f.heal(generation)
+		}()
+	}
+}
+
+// separated indica si la partición actual incomunica a dos nodos.
+// Debe llamarse con mu tomado.
+func (f *Faults) separated(a, b string) bool {
+	ga, okA := f.groups[a]
+	gb, okB := f.groups[b]
+	return okA && okB && ga != gb
+}
+
+// recordDrop registra un mensaje descartado. Debe llamarse con mu tomado.
+func (f *Faults) recordDrop(from, to, message, reason string) {
+	drop := DroppedMessage{
+		At:     time.Now(),
+		From:   from,
+		To:     to,
+		Type:   MessageType(strings.TrimSpace(message)),
+		Reason: reason,
+	}
+	f.dropped = append(f.dropped, drop)
+	if len(f.dropped) > maxDropped {
+		f.dropped = f.dropped[len(f.dropped)-maxDropped:]
+	}
+	slog.Debug("mensaje descartado por inyección de fallas", "from", from, "to", to,
+		"type", drop.Type, "reason", reason)
+}
+
+// ParsePartition interpreta una partición escrita como "8000 | 8001,8002".
+// Los elementos sin host se completan con "localhost".
+func ParsePartition(spec string) ([][]string, error) {
+	var groups [][]string
+	for _, part := range strings.Split(spec, "|") {
+		var group []string
+		for _, address := range strings.Split(part, ",") {
+			address = strings.Trim(strings.TrimSpace(address), "{}")
+			address = strings.TrimSpace(address)
+			if address == "" {
+				continue
+			}
+			group = append(group, normalizeAddress(address))
+		}
+		if len(group) == 0 {
+			return nil, fmt.Errorf("partición inválida %q: grupo vacío", spec)
+		}
+		groups = append(groups, group)
+	}
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("partición inválida %q: se necesitan al menos dos grupos", spec)
+	}
+	return groups, nil
+}
+
+// FormatPartition escribe una partición como "{a} | {b, c}"
+func FormatPartition(groups [][]string) string {
+	parts := make([]string, len(groups))
+	for i, group := range groups {
+		parts[i] = "{" + strings.Join(group, ", ") + "}"
+	}
+	return strings.Join(parts, " | ")
+}
+
+// normalizeAddress completa con "localhost" las direcciones que solo indican el puerto
+func normalizeAddress(address string) string {
+	if !strings.Contains(address, ":") {
+		return "localhost:" + address
+	}
+	return address
+}
+
+// sleepContext espera d o hasta que se cancele el contexto. Retorna false si se canceló.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,179 @@
+package node
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnauthenticatedPeer indica que la identidad del par no está respaldada
+// por su certificado TLS
+var ErrUnauthenticatedPeer = errors.New("par no autenticado")
+
+// tlsConn es una conexión que expone su estado TLS (tls.Conn y los envoltorios del transporte)
+type tlsConn interface {
+	ConnectionState() tls.ConnectionState
+}
+
+// PeerIdentity retorna la dirección del nodo al otro lado de la conexión,
+// tomada del nombre común de su certificado TLS verificado (los certificados
+// del subcomando certs usan la dirección del nodo). Sin TLS retorna false.
+func PeerIdentity(conn net.Conn) (string, bool) {
+	tc, ok := conn.(tlsConn)
+	if !ok {
+		return "", false
+	}
+	state := tc.ConnectionState()
+	if !state.HandshakeComplete || len(state.PeerCertificates) == 0 {
+		return "", false
+	}
+	return state.PeerCertificates[0].Subject.CommonName, true
+}
+
+// ExchangeKeys negocia con un par una nueva clave de sesión ECDH.
+// Envía la clave pública local y deriva la sesión con la que responde el par,
+// siempre que el certificado TLS de quien responde corresponda a ese par.
+func (n *Node) ExchangeKeys(peer string) error {
+	if n.Sessions == nil {
+		return errors.New("claves de sesión deshabilitadas")
+	}
+
+	handshake := n.Sessions.StartHandshake(peer)
+	reply, identity, err := n.request(peer, "KEY_EXCHANGE:"+handshake.PublicKey()+":"+n.Address)
+	if err != nil {
+		return err
+	}
+	if identity != peer {
+		return fmt.Errorf("%w: respondió %q en lugar de %s", ErrUnauthenticatedPeer, identity, peer)
+	}
+
+	keyID, err := handshake.Finish(reply)
+	if err != nil {
+		return err
+	}
+
+	n.Logger.Info("clave de sesión establecida", "peer", peer, "key_id", keyID)
+	return nil
+}
+
+// seal cifra un mensaje saliente con la clave de sesión del par,
+// negociándola primero si todavía no existe. Sin claves de sesión, y para el
+// propio intercambio de claves, retorna el mensaje sin cambios.
+func (n *Node) seal(peer, message string) (string, error) {
+	if n.Sessions == nil || strings.HasPrefix(message, "KEY_EXCHANGE:") || strings.HasPrefix(message, "ENC:") {
+		return message, nil
+	}
+
+	if !n.Sessions.HasSession(peer) {
+		if err := n.ExchangeKeys(peer); err != nil {
+			return "", fmt.Errorf("no se pudo negociar la sesión: %w", err)
+		}
+	}
+
+	cipherText, err := n.Sessions.Encrypt(peer, message)
+	if err != nil {
+		return "", err
+	}
+	return "ENC:" + cipherText + ":" + n.Address, nil
+}
+
+// StartKeyRotation renueva periódicamente el par ECDH local y renegocia las
+// sesiones con todos los pares, hasta que se llame a la función retornada
+func (n *Node) StartKeyRotation(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n.rotateSessionKeys()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// rotateSessionKeys genera un par ECDH nuevo y renegocia con cada par
+func (n *Node) rotateSessionKeys() {
+	if err := n.Sessions.Rotate(); err != nil {
+		n.Logger.Error("error rotando claves", "error", err)
+		return
+	}
+
+	for _, peer := range n.Peers {
+		if peer == n.Address {
+			continue
+		}
+		if err := n.ExchangeKeys(peer); err != nil {
+			n.Logger.Warn("no se pudo renegociar la sesión", "peer", peer, "error", err)
+		}
+	}
+}
+
+// handleKeyExchange responde a un intercambio de claves iniciado por un par
+func (n *Node) handleKeyExchange(message string, conn net.Conn) {
+	if n.Sessions == nil {
+		return
+	}
+
+	// Formato: KEY_EXCHANGE:<clave pública>:<dirección del par>
+	parts := strings.SplitN(message, ":", 3)
+	if len(parts) != 3 {
+		return
+	}
+	publicKey, peer := parts[1], parts[2]
+
+	// La dirección indicada en el mensaje debe coincidir con el certificado,
+	// para que ningún nodo reemplace la sesión de otro
+	if identity, ok := PeerIdentity(conn); !ok || identity != peer {
+		n.Logger.Warn("intercambio de claves rechazado", "peer", peer, "identity", identity,
+			"error", ErrUnauthenticatedPeer)
+		return
+	}
+
+	keyID, localPublic, err := n.Sessions.Accept(peer, publicKey)
+	if err != nil {
+		n.Logger.Warn("error estableciendo sesión", "peer", peer, "error", err)
+		return
+	}
+
+	conn.Write([]byte(localPublic + "\n"))
+	n.Logger.Info("clave de sesión establecida", "peer", peer, "key_id", keyID)
+}
+
+// handleEncrypted descifra un mensaje de sesión y procesa su contenido
+func (n *Node) handleEncrypted(message string, seq uint64, conn net.Conn) {
+	if n.Sessions == nil {
+		return
+	}
+
+	// Formato: ENC:<id>.<base64>:<dirección del par>. El remitente se toma
+	// del certificado TLS, igual que en el intercambio de claves.
+	parts := strings.SplitN(message, ":", 3)
+	if len(parts) != 3 {
+		return
+	}
+	cipherText, peer := parts[1], parts[2]
+	if identity, ok := PeerIdentity(conn); !ok || identity != peer {
+		n.Logger.Warn("mensaje cifrado rechazado", "peer", peer, "identity", identity,
+			"error", ErrUnauthenticatedPeer)
+		return
+	}
+
+	plaintext, err := n.Sessions.Decrypt(peer, cipherText)
+	if err != nil {
+		n.Logger.Warn("no se pudo descifrar mensaje", "peer", peer, "error", err)
+		return
+	}
+
+	n.handleFrom(peer, seq, plaintext, conn)
+}
@@ -0,0 +1,100 @@
+package node
+
+import "time"
+
+// maxOffsetHistory es la cantidad de ajustes recordados por el nodo
+const maxOffsetHistory = 100
+
+// OffsetRecord registra un ajuste de reloj calculado durante una sincronización
+type OffsetRecord struct {
+	Time      time.Time     `json:"time"`      // Hora local en que se aplicó
+	Peer      string        `json:"peer"`      // Nodo de referencia
+	Algorithm string        `json:"algorithm"` // Algoritmo que lo calculó
+	Offset    time.Duration `json:"offset"`    // Ajuste aplicado al reloj
+}
+
+// PeerStatus resume la salud de la comunicación con un par
+type PeerStatus struct {
+	Address     string    `json:"address"`
+	Healthy     bool      `json:"healthy"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	Failures    int       `json:"consecutive_failures"`
+}
+
+// RecordOffset agrega un ajuste al historial del nodo
+func (n *Node) RecordOffset(peer, algorithm string, offset time.Duration) {
+	n.statusMu.Lock()
+	defer n.statusMu.Unlock()
+
+	n.offsets = append(n.offsets, OffsetRecord{
+		Time:      n.GetClock(),
+		Peer:      peer,
+		Algorithm: algorithm,
+		Offset:    offset,
+	})
+	n.adjusted++
+	if len(n.offsets) > maxOffsetHistory {
+		n.offsets = n.offsets[len(n.offsets)-maxOffsetHistory:]
+	}
+}
+
+// OffsetHistory retorna una copia del historial de ajustes
+func (n *Node) OffsetHistory() []OffsetRecord {
+	n.statusMu.Lock()
+	defer n.statusMu.Unlock()
+	return append([]OffsetRecord(nil), n.offsets...)
+}
+
+// OffsetCount retorna la cantidad total de ajustes registrados, incluidos los
+// que ya no están en el historial
+func (n *Node) OffsetCount() int {
+	n.statusMu.Lock()
+	defer n.statusMu.Unlock()
+	return n.adjusted
+}
+
+// PeerHealth retorna el estado de cada par configurado
+func (n *Node) PeerHealth() []PeerStatus {
+	n.statusMu.Lock()
+	defer n.statusMu.Unlock()
+
+	statuses := make([]PeerStatus, 0, len(n.Peers))
+	for _, peer := range n.Peers {
+		if peer == n.Address {
+			continue
+		}
+		status, ok := n.health[peer]
+		if !ok {
+			status = PeerStatus{Address: peer}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// markPeer actualiza la salud de un par según el resultado de una conexión
+func (n *Node) markPeer(peer string, err error) {
+	n.statusMu.Lock()
+	defer n.statusMu.Unlock()
+
+	if n.health == nil {
+		n.health = make(map[string]PeerStatus)
+	}
+
+	status := n.health[peer]
+	status.Address = peer
+	if err != nil {
+		status.Healthy = false
+		status.LastFailure = time.Now()
+		status.LastError = err.Error()
+		status.Failures++
+	} else {
+		status.Healthy = true
+		status.LastSuccess = time.Now()
+		status.LastError = ""
+		status.Failures = 0
+	}
+	n.health[peer] = status
+}
@@ -0,0 +1,42 @@
+package node
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// Transport abre las conexiones del nodo. Permite reemplazar la red real por
+// envoltorios que, por ejemplo, inyectan fallas entre pares de nodos.
+type Transport interface {
+	// Listen abre el socket de escucha en la dirección indicada
+	Listen(address string) (net.Listener, error)
+	// Dial abre una conexión desde el nodo from hacia el nodo to
+	Dial(from, to string) (net.Conn, error)
+}
+
+// TCPTransport es el transporte TCP, con TLS mutuo si TLSConfig no es nil
+type TCPTransport struct {
+	TLSConfig *tls.Config
+}
+
+func (t TCPTransport) Listen(address string) (net.Listener, error) {
+	if t.TLSConfig != nil {
+		return tls.Listen("tcp", address, t.TLSConfig)
+	}
+	return net.Listen("tcp", address)
+}
+
+func (t TCPTransport) Dial(from, to string) (net.Conn, error) {
+	if t.TLSConfig != nil {
+		return tls.Dial("tcp", to, t.TLSConfig)
+	}
+	return net.Dial("tcp", to)
+}
+
+// transport retorna el transporte configurado o TCP con la configuración TLS del nodo
+func (n *Node) transport() Transport {
+	if n.Transport != nil {
+		return n.Transport
+	}
+	return TCPTransport{TLSConfig: n.TLSConfig}
+}
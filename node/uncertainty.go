@@ -0,0 +1,147 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// DefaultMaxDrift es la deriva máxima supuesta del reloj en ppm cuando el
+// nodo no configura MaxDrift (valor típico de un cristal de cuarzo)
+const DefaultMaxDrift = 200.0
+
+// ErrUnsynchronized indica que el reloj no tiene una cota de error conocida
+var ErrUnsynchronized = errors.New("reloj sin sincronizar")
+
+// TimeInterval es un intervalo que contiene la hora real
+type TimeInterval struct {
+	Earliest time.Time `json:"earliest"` // Hora real más temprana posible
+	Latest   time.Time `json:"latest"`   // Hora real más tardía posible
+}
+
+// Uncertainty retorna la mitad del ancho del intervalo
+func (i TimeInterval) Uncertainty() time.Duration {
+	return i.Latest.Sub(i.Earliest) / 2
+}
+
+// After indica si la hora t ya pasó con certeza
+func (i TimeInterval) After(t time.Time) bool {
+	return i.Earliest.After(t)
+}
+
+// Before indica si la hora t todavía no llega con certeza
+func (i TimeInterval) Before(t time.Time) bool {
+	return i.Latest.Before(t)
+}
+
+// SyncClock ajusta el reloj con una estimación cuyo error está acotado por
+// bound (por ejemplo RTT/2 en Cristian), como SetClock. La cota crece luego
+// con la deriva.
+func (n *Node) SyncClock(t time.Time, bound time.Duration) {
+	now := n.RealNow()
+	n.Mutex.Lock()
+	n.adjustClock(now, t)
+	n.errorBound = bound
+	n.errorSet = now
+	n.Mutex.Unlock()
+}
+
+// NowInterval retorna el intervalo [earliest, latest] que contiene la hora
+// real: la cota de error de la última sincronización más la deriva máxima
+// acumulada desde entonces y la corrección gradual pendiente. Retorna
+// ErrUnsynchronized si el reloj no se sincronizó con una cota o se ajustó
+// después sin ella.
+func (n *Node) NowInterval() (TimeInterval, error) {
+	now := n.RealNow()
+	n.Mutex.Lock()
+	defer n.Mutex.Unlock()
+
+	if n.errorSet.IsZero() {
+		return TimeInterval{}, ErrUnsynchronized
+	}
+	clock := n.clockAt(now)
+	bound := n.boundAt(now) + n.pendingAt(now).Abs()
+	return TimeInterval{Earliest: clock.Add(-bound), Latest: clock.Add(bound)}, nil
+}
+
+// boundAt retorna la cota de error de la última sincronización más la deriva
+// máxima acumulada hasta el instante real indicado. Debe llamarse con Mutex tomado.
+func (n *Node) boundAt(now time.Time) time.Duration {
+	return n.errorBound + time.Duration(float64(now.Sub(n.errorSet))*n.maxDrift()/1e6)
+}
+
+// WaitUntilAfter espera hasta que la hora t haya pasado con certeza según el
+// reloj local, es decir hasta que el inicio del intervalo de NowInterval sea
+// posterior a t (espera de confirmación al estilo TrueTime). No consulta a
+// otros nodos: en los demás t ya pasó solo si sus intervalos y el local
+// contienen la hora real.
+func (n *Node) WaitUntilAfter(ctx context.Context, t time.Time) error {
+	for {
+		interval, err := n.NowInterval()
+		if err != nil {
+			return err
+		}
+		if interval.After(t) {
+			return nil
+		}
+
+		// El inicio del intervalo avanza un poco más lento que el tiempo real,
+		// por lo que puede hacer falta más de una espera
+		timer := time.NewTimer(t.Sub(interval.Earliest) + time.Millisecond)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// boundSeparator separa la hora de su incertidumbre en las respuestas de hora
+const boundSeparator = " ±"
+
+// TimeReply retorna la respuesta a una solicitud de hora: la hora del reloj
+// (incluida la corrección gradual pendiente, ver TargetClock) y, si el reloj
+// tiene una cota de error conocida, su incertidumbre ("<hora> ±<cota>"). Un
+// reloj sin sincronizar se toma como referencia exacta.
+func (n *Node) TimeReply() string {
+	now := n.RealNow()
+	n.Mutex.Lock()
+	defer n.Mutex.Unlock()
+
+	clock := FormatTime(n.clockAt(now).Add(n.pendingAt(now)))
+	if n.errorSet.IsZero() {
+		return clock
+	}
+	// La hora informada ya incluye la corrección pendiente, por lo que la
+	// incertidumbre no la suma
+	return clock + boundSeparator + n.boundAt(now).String()
+}
+
+// ParseTimeReply interpreta una respuesta de TimeReply. La incertidumbre es
+// cero si la respuesta no la indica.
+func ParseTimeReply(s string) (time.Time, time.Duration, error) {
+	clock, bound, found := strings.Cut(strings.TrimSpace(s), boundSeparator)
+	t, err := ParseTime(clock)
+	if err != nil || !found {
+		return t, 0, err
+	}
+	uncertainty, err := time.ParseDuration(bound)
+	if err != nil || uncertainty < 0 {
+		return time.Time{}, 0, fmt.Errorf("incertidumbre inválida: %q", bound)
+	}
+	return t, uncertainty, nil
+}
+
+// maxDrift retorna la deriva máxima supuesta en ppm. Nunca es menor que la
+// deriva configurada del nodo, para que el intervalo siempre la cubra.
+func (n *Node) maxDrift() float64 {
+	drift := n.MaxDrift
+	if drift <= 0 {
+		drift = DefaultMaxDrift
+	}
+	return max(drift, math.Abs(n.Drift))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"solemne3_SO/utils"
+	"strings"
+)
+
+// runPasswd implementa el subcomando "passwd": crea o actualiza un usuario
+// del API de administración en el archivo de credenciales. La contraseña se
+// lee de la entrada estándar y no de un flag, para que no quede en el
+// historial de la shell ni en la lista de procesos.
+func runPasswd(args []string) {
+	fs := flag.NewFlagSet("passwd", flag.ExitOnError)
+	file := fs.String("file", "users.txt", "Archivo usuario:hash con las credenciales")
+	user := fs.String("user", "", "Nombre del usuario")
+	fs.Parse(args)
+
+	if *user == "" {
+		fmt.Println("Uso: passwd -file users.txt -user <usuario> (la contraseña se lee de la entrada estándar)")
+		os.Exit(1)
+	}
+
+	password, err := leerContraseña(os.Stdin, terminal(os.Stdin))
+	if err != nil {
+		fmt.Println("Error leyendo contraseña:", err)
+		os.Exit(1)
+	}
+
+	store, err := utils.LoadPasswordStore(*file)
+	if err != nil {
+		fmt.Println("Error cargando credenciales:", err)
+		os.Exit(1)
+	}
+
+	if err := store.SetPassword(*user, password); err != nil {
+		fmt.Println("Error guardando contraseña:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Contraseña actualizada para", *user)
+}
+
+// terminal indica si el archivo es una terminal interactiva
+func terminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// leerContraseña lee la contraseña de la primera línea de r. En una terminal
+// la pide dos veces y comprueba que coincidan.
+func leerContraseña(r io.Reader, interactivo bool) (string, error) {
+	lector := bufio.NewReader(r)
+	leer := func(prompt string) (string, error) {
+		if interactivo {
+			fmt.Fprint(os.Stderr, prompt)
+		}
+		linea, err := lector.ReadString('\n')
+		if err == io.EOF && linea == "" {
+			return "", errors.New("no se recibió la contraseña")
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimRight(linea, "\r\n"), nil
+	}
+
+	password, err := leer("Contraseña: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", errors.New("contraseña vacía")
+	}
+	if interactivo {
+		confirmacion, err := leer("Repetir contraseña: ")
+		if err != nil {
+			return "", err
+		}
+		if confirmacion != password {
+			return "", errors.New("las contraseñas no coinciden")
+		}
+	}
+	return password, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"solemne3_SO/node"
+	"solemne3_SO/sync"
+	gosync "sync"
+	"time"
+)
+
+// syncRunner ejecuta rondas de sincronización con el algoritmo seleccionado,
+// que puede cambiarse en tiempo de ejecución desde el API de administración
+type syncRunner struct {
+	ctx     context.Context
+	node    *node.Node
+	mu      gosync.Mutex      // Protege el algoritmo actual
+	current sync.Synchronizer // Algoritmo en uso
+	roundM  gosync.Mutex      // Evita rondas simultáneas
+	loops   gosync.WaitGroup  // Rondas periódicas en ejecución
+}
+
+// snapshotState retorna el estado de la aplicación que el nodo incluye en las
+// instantáneas globales: el algoritmo en uso y los ajustes de reloj aplicados
+func snapshotState(n *node.Node, r *syncRunner) sync.SnapshotStateFunc {
+	return func() any {
+		return map[string]any{
+			"algorithm": r.Algorithm(),
+			"offsets":   len(n.OffsetHistory()),
+		}
+	}
+}
+
+// newSyncRunner crea el ejecutor de rondas para un nodo e inicia el algoritmo indicado
+func newSyncRunner(ctx context.Context, n *node.Node, algo string) (*syncRunner, error) {
+	r := &syncRunner{ctx: ctx, node: n}
+	if err := r.SetAlgorithm(algo); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Algorithm retorna el algoritmo actual
+func (r *syncRunner) Algorithm() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current.Name()
+}
+
+// SetAlgorithm busca el algoritmo en el registro, detiene el anterior y lo
+// inicia. El anterior se detiene primero porque los algoritmos con el mismo
+// prefijo de mensajes comparten el manejador, y detenerlo después eliminaría
+// el del nuevo. El cambio espera la ronda en curso.
+func (r *syncRunner) SetAlgorithm(name string) error {
+	next, err := sync.New(name)
+	if err != nil {
+		return err
+	}
+
+	r.roundM.Lock()
+	defer r.roundM.Unlock()
+
+	r.mu.Lock()
+	previous := r.current
+	r.mu.Unlock()
+
+	if previous != nil {
+		if err := previous.Stop(); err != nil {
+			r.node.Logger.Warn("error deteniendo algoritmo", "algorithm", previous.Name(), "error", err)
+		}
+	}
+
+	if err := next.Start(r.ctx, r.node); err != nil {
+		if previous != nil {
+			// Volver al algoritmo anterior con una instancia nueva
+			r.restart(previous.Name())
+		}
+		return err
+	}
+
+	r.mu.Lock()
+	r.current = next
+	r.mu.Unlock()
+
+	if previous != nil {
+		r.node.Logger.Info("algoritmo cambiado", "algorithm", name, "previous", previous.Name())
+	}
+	return nil
+}
+
+// restart inicia otra vez el algoritmo indicado después de un cambio fallido
+func (r *syncRunner) restart(name string) {
+	again, err := sync.New(name)
+	if err == nil {
+		err = again.Start(r.ctx, r.node)
+	}
+	if err != nil {
+		r.node.Logger.Error("no se pudo restaurar el algoritmo", "algorithm", name, "error", err)
+		return
+	}
+	r.mu.Lock()
+	r.current = again
+	r.mu.Unlock()
+}
+
+// SyncRound ejecuta una ronda del algoritmo actual
+func (r *syncRunner) SyncRound() error {
+	r.roundM.Lock()
+	defer r.roundM.Unlock()
+
+	r.mu.Lock()
+	current := r.current
+	r.mu.Unlock()
+
+	r.node.Logger.Info("sincronizando", "algorithm", current.Name())
+	return current.SyncOnce(r.ctx)
+}
+
+// Run ejecuta rondas periódicas en segundo plano hasta que se cancele el contexto
+func (r *syncRunner) Run(interval time.Duration) {
+	r.loops.Add(1)
+	go func() {
+		defer r.loops.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := r.SyncRound(); err != nil {
+					r.node.Logger.Warn("ronda de sincronización incompleta", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop espera que terminen las rondas en curso y detiene el algoritmo actual.
+// Las rondas periódicas terminan al cancelarse el contexto del ejecutor.
+func (r *syncRunner) Stop() error {
+	r.loops.Wait()
+
+	r.roundM.Lock()
+	defer r.roundM.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current.Stop()
+}
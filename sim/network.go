@@ -0,0 +1,285 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// Network es una red en memoria que implementa node.Transport, de modo que
+// los nodos reales se comunican a través de ella. Cada escritura llega al otro
+// extremo con una latencia tomada de la distribución configurada, en orden
+// dentro de la misma conexión.
+type Network struct {
+	sim       *Simulator
+	Latency   node.Latency
+	Messages  int // Mensajes (escrituras) enviados
+	listeners map[string]*listener
+	conns     []*conn
+	closed    bool
+}
+
+// NewNetwork crea una red simulada con la distribución de latencia indicada
+func NewNetwork(s *Simulator, latency node.Latency) *Network {
+	return &Network{sim: s, Latency: latency, listeners: make(map[string]*listener)}
+}
+
+// Listen abre el socket de escucha de un nodo simulado
+func (n *Network) Listen(address string) (net.Listener, error) {
+	n.sim.mu.Lock()
+	defer n.sim.mu.Unlock()
+	if _, ok := n.listeners[address]; ok {
+		return nil, fmt.Errorf("dirección en uso: %s", address)
+	}
+	l := &listener{net: n, address: address, ready: sync.NewCond(&n.sim.mu)}
+	n.listeners[address] = l
+	return l, nil
+}
+
+// Dial abre una conexión desde el nodo from hacia el nodo to. El otro
+// extremo la acepta cuando llega el primer mensaje.
+func (n *Network) Dial(from, to string) (net.Conn, error) {
+	n.sim.mu.Lock()
+	defer n.sim.mu.Unlock()
+	l := n.listeners[to]
+	if n.closed || l == nil {
+		return nil, &net.OpError{Op: "dial", Net: "sim", Addr: addr(to), Err: errors.New("conexión rechazada")}
+	}
+
+	client := &conn{net: n, local: from, remote: to}
+	server := &conn{net: n, local: to, remote: from, listener: l}
+	client.peer, server.peer = server, client
+	n.conns = append(n.conns, client, server)
+	return client, nil
+}
+
+// Close cierra todas las conexiones para liberar a las goroutinas que
+// esperan mensajes que ya no llegarán
+func (n *Network) Close() {
+	n.sim.mu.Lock()
+	defer n.sim.mu.Unlock()
+	n.closed = true
+	for _, c := range n.conns {
+		c.closeLocked()
+	}
+	n.conns = nil
+}
+
+// deliver entrega datos (o el fin de la conexión si data es nil) en el
+// extremo c. Debe llamarse con mu tomado.
+func (n *Network) deliver(c *conn, data []byte) {
+	if c.closed {
+		return
+	}
+	if c.listener != nil && !c.accepted {
+		if !c.listener.enqueue(c) {
+			c.closed = true
+			return
+		}
+	}
+
+	if data == nil {
+		c.eof = true
+	} else {
+		n.sim.record(c.local, "recv", describe(data)+" <- "+c.remote)
+		c.buf = append(c.buf, data...)
+	}
+	n.sim.wake(&c.reader)
+}
+
+// describe resume el contenido de un mensaje para la traza
+func describe(data []byte) string {
+	return strings.TrimSpace(string(data))
+}
+
+// addr es la dirección de un nodo simulado
+type addr string
+
+func (a addr) Network() string { return "sim" }
+func (a addr) String() string  { return string(a) }
+
+// listener acepta las conexiones entrantes de un nodo simulado
+type listener struct {
+	net     *Network
+	address string
+	queue   []*conn
+	ready   *sync.Cond
+	closed  bool
+}
+
+// enqueue agrega una conexión entrante a la cola de Accept. La conexión
+// cuenta como actividad hasta que el nodo la cierre o espere otro mensaje,
+// para que Run no avance mientras el nodo la atiende. Debe llamarse con mu
+// tomado. Retorna false si el listener está cerrado.
+func (l *listener) enqueue(c *conn) bool {
+	if l.closed {
+		return false
+	}
+	c.accepted = true
+	c.held = true
+	l.net.sim.active++
+	l.queue = append(l.queue, c)
+	l.ready.Signal()
+	return true
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	l.net.sim.mu.Lock()
+	defer l.net.sim.mu.Unlock()
+	for len(l.queue) == 0 && !l.closed {
+		l.ready.Wait()
+	}
+	if l.closed {
+		return nil, net.ErrClosed
+	}
+	c := l.queue[0]
+	l.queue = l.queue[1:]
+	return c, nil
+}
+
+func (l *listener) Close() error {
+	l.net.sim.mu.Lock()
+	defer l.net.sim.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	delete(l.net.listeners, l.address)
+	for _, c := range l.queue {
+		c.closeLocked()
+	}
+	l.queue = nil
+	l.ready.Broadcast()
+	return nil
+}
+
+func (l *listener) Addr() net.Addr { return addr(l.address) }
+
+// conn es un extremo de una conexión simulada
+type conn struct {
+	net      *Network
+	local    string
+	remote   string
+	peer     *conn
+	listener *listener // Listener que acepta este extremo (nil en el que marca)
+
+	buf      []byte        // Datos recibidos sin leer
+	eof      bool          // El otro extremo cerró la conexión
+	closed   bool          // Este extremo se cerró
+	accepted bool          // Ya se entregó a Accept
+	held     bool          // Cuenta como actividad mientras el nodo la atiende
+	sent     time.Duration // Instante de llegada del último mensaje enviado
+	deadline time.Time     // Plazo de lectura en hora real simulada
+	reader   waiter        // Goroutina esperando datos
+	waits    uint64        // Esperas de lectura (descarta plazos vencidos de esperas anteriores)
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	s := c.net.sim
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		switch {
+		case c.closed:
+			return 0, net.ErrClosed
+		case len(c.buf) > 0:
+			n := copy(p, c.buf)
+			c.buf = c.buf[n:]
+			return n, nil
+		case c.eof:
+			return 0, io.EOF
+		case !c.deadline.IsZero() && !Epoch.Add(s.now).Before(c.deadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		c.waits++
+		if !c.deadline.IsZero() {
+			wait := c.waits
+			s.scheduleAt(c.deadline.Sub(Epoch), func() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				if c.waits == wait {
+					s.wake(&c.reader)
+				}
+			})
+		}
+		s.wait(&c.reader)
+	}
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	s := c.net.sim
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	data := append([]byte(nil), p...)
+	c.net.Messages++
+	s.record(c.local, "send", describe(data)+" -> "+c.remote)
+	c.sent = max(s.now+c.net.Latency.Sample(s.rng), c.sent)
+	s.scheduleAt(c.sent, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		c.net.deliver(c.peer, data)
+	})
+	return len(p), nil
+}
+
+// Close cierra este extremo. El otro extremo recibe el fin de la conexión
+// después de los mensajes que ya estaban en camino.
+func (c *conn) Close() error {
+	s := c.net.sim
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closeLocked()
+	if !c.net.closed {
+		s.scheduleAt(c.sent, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			c.net.deliver(c.peer, nil)
+		})
+	}
+	return nil
+}
+
+// closeLocked cierra este extremo y deja de contarlo como actividad. Debe
+// llamarse con mu tomado.
+func (c *conn) closeLocked() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.net.sim.wake(&c.reader)
+	if c.held {
+		c.held = false
+		c.net.sim.releaseLocked()
+	}
+}
+
+func (c *conn) LocalAddr() net.Addr  { return addr(c.local) }
+func (c *conn) RemoteAddr() net.Addr { return addr(c.remote) }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.net.sim.mu.Lock()
+	defer c.net.sim.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,229 @@
+package sim
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"solemne3_SO/node"
+	"solemne3_SO/sync"
+)
+
+// Algorithms son los algoritmos disponibles en la simulación. Solo se incluyen
+// los que ejecutan cada ronda en la goroutina de SyncOnce: los que esperan
+// con temporizadores reales o lanzan goroutinas propias no avanzan en el
+// tiempo virtual.
+var Algorithms = []string{"cristian", "berkeley", "logical"}
+
+// Config describe un escenario de simulación
+type Config struct {
+	Seed      uint64          // Semilla del generador aleatorio
+	Nodes     int             // Cantidad de nodos
+	Algorithm string          // Algoritmo a ejecutar (ver Algorithms)
+	Rounds    int             // Rondas que ejecuta cada nodo
+	Interval  time.Duration   // Tiempo virtual entre rondas
+	Latency   node.Latency    // Distribución de la latencia de la red
+	Skews     []time.Duration // Desfase inicial de cada nodo (faltantes en cero)
+	Drifts    []float64       // Deriva de cada nodo en ppm (faltantes en cero)
+	Leader    int             // Único nodo que ejecuta rondas (-1 las ejecuta en todos, salvo en los algoritmos con coordinador, que usan el nodo 0)
+}
+
+// Result es el estado final de una simulación
+type Result struct {
+	Offsets     []time.Duration // Desfase final de cada reloj respecto a la hora real
+	Adjustments []int           // Ajustes aplicados a cada reloj
+	Lamport     []int           // Valor final del reloj de Lamport de cada nodo
+	Spread      time.Duration   // Diferencia entre el reloj más adelantado y el más atrasado
+	Messages    int             // Mensajes enviados por la red
+	Events      int             // Eventos procesados
+	Skipped     int             // Rondas omitidas porque la anterior no había terminado
+	Elapsed     time.Duration   // Tiempo virtual simulado
+	Trace       Trace           // Traza completa de eventos
+}
+
+// Node es un nodo real (node.Node) conectado a la red simulada, con el
+// sincronizador del algoritmo de la simulación
+type Node struct {
+	ID          string
+	Node        *node.Node
+	Sync        sync.Synchronizer
+	adjustments int  // Ajustes ya registrados en la traza
+	busy        bool // Indica si hay una ronda en curso
+}
+
+// Cluster agrupa los nodos de una simulación con su red
+type Cluster struct {
+	Sim   *Simulator
+	Net   *Network
+	Nodes []*Node
+}
+
+// NewCluster crea los nodos con sus desfases y derivas iniciales. Los nodos
+// usan la red simulada como transporte y el tiempo virtual como hora real.
+func NewCluster(s *Simulator, latency node.Latency, skews []time.Duration, drifts []float64, count int) *Cluster {
+	c := &Cluster{Sim: s, Net: NewNetwork(s, latency)}
+	s.afterEvent = c.recordAdjustments
+
+	addresses := make([]string, count)
+	for i := range count {
+		addresses[i] = "n" + strconv.Itoa(i)
+	}
+	for i, address := range addresses {
+		n := node.NewNode(address, address, addresses)
+		n.Transport = c.Net
+		n.TimeSource = s.RealTime
+		n.Logger = slog.New(slog.DiscardHandler)
+		if i < len(drifts) {
+			n.Drift = drifts[i]
+		}
+		var skew time.Duration
+		if i < len(skews) {
+			skew = skews[i]
+		}
+		n.SetClock(s.RealTime().Add(skew))
+		c.Nodes = append(c.Nodes, &Node{ID: address, Node: n})
+	}
+	return c
+}
+
+// Start inicia los nodos y el sincronizador del algoritmo en cada uno
+func (c *Cluster) Start(ctx context.Context, algorithm string) error {
+	for _, n := range c.Nodes {
+		if err := n.Node.Start(ctx); err != nil {
+			return err
+		}
+		synchronizer, err := sync.New(algorithm)
+		if err != nil {
+			return err
+		}
+		if err := synchronizer.Start(ctx, n.Node); err != nil {
+			return fmt.Errorf("no se pudo iniciar %s en %s: %w", algorithm, n.ID, err)
+		}
+		n.Sync = synchronizer
+	}
+	return nil
+}
+
+// Close detiene los sincronizadores y los nodos. Las rondas que esperaban
+// mensajes posteriores al fin de la simulación terminan con error.
+func (c *Cluster) Close() {
+	c.Net.Close()
+	c.Sim.Wait()
+	for _, n := range c.Nodes {
+		if n.Sync != nil {
+			n.Sync.Stop()
+		}
+		n.Node.Shutdown(context.Background())
+	}
+}
+
+// Round inicia una ronda del sincronizador en un nodo. Si la ronda anterior
+// del mismo nodo no terminó, la nueva se omite (igual que en el nodo real,
+// donde las rondas no se superponen). Retorna false si la ronda se omitió.
+func (c *Cluster) Round(ctx context.Context, n *Node) bool {
+	if n.busy {
+		c.Sim.Record(n.ID, "skip", n.Sync.Name())
+		return false
+	}
+	n.busy = true
+	c.Sim.Record(n.ID, "round", n.Sync.Name())
+
+	c.Sim.Go(func() {
+		if err := n.Sync.SyncOnce(ctx); err != nil {
+			c.Sim.Record(n.ID, "error", err.Error())
+		}
+		n.busy = false
+	})
+	return true
+}
+
+// recordAdjustments agrega a la traza los ajustes de reloj aplicados por los
+// nodos durante el último evento
+func (c *Cluster) recordAdjustments() {
+	for _, n := range c.Nodes {
+		count := n.Node.OffsetCount()
+		if count == n.adjustments {
+			continue
+		}
+		history := n.Node.OffsetHistory()
+		for _, r := range history[max(len(history)-(count-n.adjustments), 0):] {
+			c.Sim.Record(n.ID, "adjust", fmt.Sprintf("%s peer=%s offset=%s", r.Algorithm, r.Peer, r.Offset))
+		}
+		n.adjustments = count
+	}
+}
+
+// Offset retorna la diferencia entre el reloj del nodo y la hora real simulada
+func (c *Cluster) Offset(n *Node) time.Duration {
+	return n.Node.GetClock().Sub(c.Sim.RealTime())
+}
+
+// Run ejecuta un escenario completo y retorna su resultado
+func Run(cfg Config) (Result, error) {
+	if !slices.Contains(Algorithms, cfg.Algorithm) {
+		return Result{}, fmt.Errorf("algoritmo no soportado en la simulación: %s", cfg.Algorithm)
+	}
+	if cfg.Nodes < 1 {
+		return Result{}, fmt.Errorf("se necesita al menos un nodo")
+	}
+	if cfg.Leader >= cfg.Nodes {
+		return Result{}, fmt.Errorf("líder fuera de rango: %d", cfg.Leader)
+	}
+	if cfg.Latency == nil {
+		cfg.Latency = node.Fixed(time.Millisecond)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Leader < 0 && sync.NeedsCoordinator(cfg.Algorithm) {
+		cfg.Leader = 0
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(cfg.Seed)
+	c := NewCluster(s, cfg.Latency, cfg.Skews, cfg.Drifts, cfg.Nodes)
+	defer c.Close()
+	if err := c.Start(ctx, cfg.Algorithm); err != nil {
+		return Result{}, err
+	}
+
+	// Programar las rondas de cada nodo con un pequeño desfase aleatorio para
+	// que no partan todas en el mismo instante
+	var skipped int
+	for i, n := range c.Nodes {
+		if cfg.Leader >= 0 && i != cfg.Leader {
+			continue
+		}
+		start := time.Duration(s.Rand().Int64N(int64(cfg.Interval/10) + 1))
+		for round := range cfg.Rounds {
+			s.Schedule(start+time.Duration(round)*cfg.Interval, func() {
+				if !c.Round(ctx, n) {
+					skipped++
+				}
+			})
+		}
+	}
+
+	end := time.Duration(cfg.Rounds) * cfg.Interval
+	events := s.Run(end)
+
+	result := Result{
+		Messages: c.Net.Messages,
+		Events:   events,
+		Skipped:  skipped,
+		Elapsed:  s.Now(),
+		Trace:    s.Trace(),
+	}
+	for _, n := range c.Nodes {
+		result.Offsets = append(result.Offsets, c.Offset(n))
+		result.Adjustments = append(result.Adjustments, n.Node.OffsetCount())
+		result.Lamport = append(result.Lamport, sync.RelojDeNodo(n.Node).Get())
+	}
+	result.Spread = slices.Max(result.Offsets) - slices.Min(result.Offsets)
+	return result, nil
+}
@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"container/heap"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Epoch es la hora real que corresponde al instante cero de la simulación
+var Epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Simulator es un simulador de eventos discretos. El tiempo es virtual: avanza
+// de un evento al siguiente sin esperar, por lo que miles de rondas se
+// ejecutan en milisegundos. Con la misma semilla se obtiene la misma traza.
+//
+// Los eventos pueden iniciar goroutinas (Go) que usan la red simulada. Antes
+// de procesar el siguiente evento Run espera que todas terminen o queden
+// bloqueadas esperando un mensaje, por lo que el código real de los nodos
+// avanza paso a paso en el tiempo virtual.
+type Simulator struct {
+	mu     sync.Mutex
+	idle   *sync.Cond // Se señala cuando no quedan goroutinas activas
+	active int        // Goroutinas de la simulación que no están bloqueadas
+	rng    *rand.Rand
+	now    time.Duration // Tiempo virtual transcurrido desde Epoch
+	seq    uint64        // Orden de creación de los eventos (desempata instantes iguales)
+	events eventQueue
+	trace  Trace
+
+	running    sync.WaitGroup // Goroutinas iniciadas con Go
+	afterEvent func()         // Se ejecuta después de cada evento, sin goroutinas activas
+}
+
+// New crea un simulador con un generador aleatorio a partir de la semilla
+func New(seed uint64) *Simulator {
+	s := &Simulator{rng: rand.New(rand.NewPCG(seed, seed))}
+	s.idle = sync.NewCond(&s.mu)
+	return s
+}
+
+// Now retorna el tiempo virtual transcurrido desde el inicio
+func (s *Simulator) Now() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+// RealTime retorna la hora real simulada del instante actual. Sirve como
+// fuente de hora de los nodos (node.Node.TimeSource).
+func (s *Simulator) RealTime() time.Time {
+	return Epoch.Add(s.Now())
+}
+
+// Rand retorna el generador aleatorio de la simulación. Todo valor aleatorio
+// debe salir de aquí para que la ejecución sea reproducible.
+func (s *Simulator) Rand() *rand.Rand {
+	return s.rng
+}
+
+// Schedule programa una función para ejecutarse después de delay
+func (s *Simulator) Schedule(delay time.Duration, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scheduleAt(s.now+max(delay, 0), fn)
+}
+
+// scheduleAt programa una función en un instante virtual. Debe llamarse con mu tomado.
+func (s *Simulator) scheduleAt(at time.Duration, fn func()) {
+	s.seq++
+	heap.Push(&s.events, event{at: max(at, s.now), seq: s.seq, fn: fn})
+}
+
+// Go ejecuta fn en una goroutina que cuenta como actividad de la simulación:
+// Run no procesa el siguiente evento hasta que fn termine o se bloquee
+// esperando un mensaje de la red simulada
+func (s *Simulator) Go(fn func()) {
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer s.release()
+		fn()
+	}()
+}
+
+// Wait espera que terminen las goroutinas iniciadas con Go
+func (s *Simulator) Wait() {
+	s.running.Wait()
+}
+
+// release descuenta una goroutina activa
+func (s *Simulator) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+// releaseLocked descuenta una goroutina activa. Debe llamarse con mu tomado.
+func (s *Simulator) releaseLocked() {
+	s.active--
+	if s.active == 0 {
+		s.idle.Broadcast()
+	}
+}
+
+// waiter es una goroutina bloqueada en la red simulada. Mientras espera no
+// cuenta como activa.
+type waiter struct {
+	cond    *sync.Cond
+	waiting bool
+}
+
+// wait bloquea la goroutina actual hasta que se llame a wake. Debe llamarse
+// con mu tomado.
+func (s *Simulator) wait(w *waiter) {
+	if w.cond == nil {
+		w.cond = sync.NewCond(&s.mu)
+	}
+	w.waiting = true
+	s.releaseLocked()
+	for w.waiting {
+		w.cond.Wait()
+	}
+}
+
+// wake despierta a la goroutina si está esperando y la vuelve a contar como
+// activa. Debe llamarse con mu tomado.
+func (s *Simulator) wake(w *waiter) {
+	if !w.waiting {
+		return
+	}
+	w.waiting = false
+	s.active++
+	w.cond.Signal()
+}
+
+// Run procesa los eventos programados hasta until y deja el tiempo virtual en
+// until. Los eventos posteriores quedan pendientes. Retorna la cantidad de
+// eventos procesados.
+func (s *Simulator) Run(until time.Duration) int {
+	processed := 0
+	for {
+		s.mu.Lock()
+		for s.active > 0 {
+			s.idle.Wait()
+		}
+		s.mu.Unlock()
+		if s.afterEvent != nil {
+			s.afterEvent()
+		}
+
+		s.mu.Lock()
+		if s.events.Len() == 0 || s.events[0].at > until {
+			s.now = max(s.now, until)
+			s.mu.Unlock()
+			return processed
+		}
+		e := heap.Pop(&s.events).(event)
+		s.now = e.at
+		s.mu.Unlock()
+
+		e.fn()
+		processed++
+	}
+}
+
+// Record agrega una entrada a la traza en el instante actual
+func (s *Simulator) Record(node, kind, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(node, kind, detail)
+}
+
+// record agrega una entrada a la traza. Debe llamarse con mu tomado.
+func (s *Simulator) record(node, kind, detail string) {
+	s.trace = append(s.trace, TraceEntry{At: s.now, Node: node, Kind: kind, Detail: detail})
+}
+
+// Trace retorna la traza registrada hasta el momento
+func (s *Simulator) Trace() Trace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trace
+}
+
+// event es una función programada en un instante virtual
+type event struct {
+	at  time.Duration
+	seq uint64
+	fn  func()
+}
+
+// eventQueue es un min-heap de eventos ordenados por instante y creación
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x any)   { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
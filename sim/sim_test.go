@@ -0,0 +1,234 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// kinds retorna los tipos de las entradas de la traza, con su nodo
+func kinds(t Trace) []string {
+	var out []string
+	for _, e := range t {
+		out = append(out, e.Node+" "+e.Kind)
+	}
+	return out
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			cfg := Config{
+				Seed:      7,
+				Nodes:     4,
+				Algorithm: algorithm,
+				Rounds:    50,
+				Interval:  time.Second,
+				Latency:   node.Uniform{Min: time.Millisecond, Max: 20 * time.Millisecond},
+				Skews:     []time.Duration{0, 2 * time.Second, -time.Second, 500 * time.Millisecond},
+				Drifts:    []float64{0, 50, -100, 20},
+				Leader:    -1,
+			}
+			first, err := Run(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := Run(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Trace.Digest() != second.Trace.Digest() {
+				t.Fatalf("la misma semilla produjo trazas distintas (%d y %d eventos)", len(first.Trace), len(second.Trace))
+			}
+			for i := range first.Offsets {
+				if first.Offsets[i] != second.Offsets[i] {
+					t.Errorf("desfase final de n%d: %s y %s", i, first.Offsets[i], second.Offsets[i])
+				}
+			}
+
+			// Los algoritmos de reloj físico deben acercar los relojes, que
+			// parten con 3s de dispersión; la latencia de hasta 20ms limita la
+			// precisión
+			if algorithm != "logical" && first.Spread > 50*time.Millisecond {
+				t.Errorf("dispersión final = %s tras %d rondas, se esperaba menos de 50ms", first.Spread, cfg.Rounds)
+			}
+
+			cfg.Seed = 8
+			other, err := Run(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other.Trace.Digest() == first.Trace.Digest() {
+				t.Error("semillas distintas produjeron la misma traza")
+			}
+		})
+	}
+}
+
+func TestCristianRound(t *testing.T) {
+	result, err := Run(Config{
+		Seed:      1,
+		Nodes:     2,
+		Algorithm: "cristian",
+		Rounds:    1,
+		Latency:   node.Fixed(time.Millisecond),
+		Skews:     []time.Duration{0, time.Second},
+		Leader:    0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"n0 round", "n0 send", "n1 recv", "n1 send", "n0 recv", "n0 adjust"}
+	if got := kinds(result.Trace); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("traza = %v, se esperaba %v", got, want)
+	}
+	if d := result.Trace[0].Detail; d != "cristian" {
+		t.Errorf("ronda = %q", d)
+	}
+	if d := result.Trace[1].Detail; d != "TIME_REQUEST -> n1" {
+		t.Errorf("solicitud = %q", d)
+	}
+	if rtt := result.Trace[4].At - result.Trace[1].At; rtt != 2*time.Millisecond {
+		t.Errorf("RTT = %s, se esperaba 2ms", rtt)
+	}
+	if d := result.Trace[5].Detail; !strings.HasPrefix(d, "cristian peer=n1 ") {
+		t.Errorf("ajuste = %q", d)
+	}
+
+	// Con latencia simétrica la estimación de Cristian es exacta, salvo el
+	// redondeo a microsegundos del formato de hora
+	for i, offset := range result.Offsets {
+		if (offset - time.Second).Abs() > time.Microsecond {
+			t.Errorf("desfase final de n%d = %s, se esperaba 1s", i, offset)
+		}
+	}
+	if result.Adjustments[0] != 1 || result.Adjustments[1] != 0 {
+		t.Errorf("ajustes = %v, se esperaba [1 0]", result.Adjustments)
+	}
+}
+
+func TestBerkeleyAverages(t *testing.T) {
+	result, err := Run(Config{
+		Seed:      1,
+		Nodes:     3,
+		Algorithm: "berkeley",
+		Rounds:    1,
+		Latency:   node.Fixed(time.Millisecond),
+		Skews:     []time.Duration{0, 3 * time.Second, -3 * time.Second},
+		Leader:    0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Berkeley no compensa la latencia: el coordinador ve cada hora 1ms
+	// después de leída, por lo que el promedio queda a menos de 2ms de la hora real
+	for i, offset := range result.Offsets {
+		if offset.Abs() > 2*time.Millisecond {
+			t.Errorf("desfase final de n%d = %s", i, offset)
+		}
+	}
+	for i, count := range result.Adjustments {
+		if count != 1 {
+			t.Errorf("ajustes de n%d = %d, se esperaba 1", i, count)
+		}
+	}
+
+	var adjusts []string
+	for _, e := range result.Trace {
+		if e.Kind == "adjust" {
+			adjusts = append(adjusts, e.Node)
+		}
+	}
+	if want := []string{"n0", "n1", "n2"}; strings.Join(adjusts, ",") != strings.Join(want, ",") {
+		t.Errorf("ajustes en la traza = %v, se esperaba %v", adjusts, want)
+	}
+}
+
+func TestLogicalLamport(t *testing.T) {
+	result, err := Run(Config{
+		Seed:      1,
+		Nodes:     3,
+		Algorithm: "logical",
+		Rounds:    1,
+		Latency:   node.Fixed(time.Millisecond),
+		Leader:    0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// n0 marca sus mensajes con 1 y 2; cada receptor toma el máximo y suma uno
+	want := []int{2, 2, 3}
+	for i := range want {
+		if result.Lamport[i] != want[i] {
+			t.Errorf("Lamport = %v, se esperaba %v", result.Lamport, want)
+			break
+		}
+	}
+	if result.Messages != 2 {
+		t.Errorf("mensajes = %d, se esperaba 2", result.Messages)
+	}
+}
+
+func TestRequestTimesOutInVirtualTime(t *testing.T) {
+	result, err := Run(Config{
+		Seed:      1,
+		Nodes:     2,
+		Algorithm: "cristian",
+		Rounds:    2,
+		Interval:  time.Minute,
+		Latency:   node.Fixed(10 * time.Second),
+		Leader:    0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// La respuesta tardaría 20s y node.RequestTimeout es 5s
+	var errs int
+	for _, e := range result.Trace {
+		if e.Kind == "error" {
+			errs++
+		}
+		if e.Kind == "adjust" {
+			t.Errorf("ajuste inesperado: %s", e)
+		}
+	}
+	if errs != 2 {
+		t.Errorf("rondas con error = %d, se esperaba 2", errs)
+	}
+	if result.Adjustments[0] != 0 {
+		t.Errorf("ajustes = %v", result.Adjustments)
+	}
+}
+
+func TestBerkeleyDefaultLeaderConverges(t *testing.T) {
+	// Con Leader -1 Berkeley usa un solo coordinador: si todos los nodos
+	// coordinaran rondas a la vez los ajustes se superpondrían y los relojes
+	// divergirían
+	result, err := Run(Config{
+		Seed:      1,
+		Nodes:     3,
+		Algorithm: "berkeley",
+		Rounds:    20,
+		Latency:   node.Uniform{Min: time.Millisecond, Max: 5 * time.Millisecond},
+		Skews:     []time.Duration{0, 2 * time.Second, -1500 * time.Millisecond},
+		Leader:    -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Spread > 10*time.Millisecond {
+		t.Errorf("dispersión final = %s, se esperaba menos de 10ms", result.Spread)
+	}
+	for i, count := range result.Adjustments {
+		if count != 20 {
+			t.Errorf("ajustes de n%d = %d, se esperaba uno por ronda", i, count)
+		}
+	}
+}
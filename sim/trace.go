@@ -0,0 +1,42 @@
+package sim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+)
+
+// TraceEntry es un evento registrado durante la simulación
+type TraceEntry struct {
+	At     time.Duration // Instante virtual del evento
+	Node   string        // Nodo donde ocurrió
+	Kind   string        // Tipo de evento (send, recv, adjust, ...)
+	Detail string        // Descripción del evento
+}
+
+func (e TraceEntry) String() string {
+	return fmt.Sprintf("%14s %-4s %-8s %s", e.At, e.Node, e.Kind, e.Detail)
+}
+
+// Trace es la secuencia de eventos de una simulación
+type Trace []TraceEntry
+
+// Write escribe la traza con un evento por línea
+func (t Trace) Write(w io.Writer) error {
+	for _, e := range t {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Digest resume la traza en un hash SHA-256. Dos ejecuciones con la misma
+// semilla y configuración producen el mismo resumen.
+func (t Trace) Digest() string {
+	h := sha256.New()
+	t.Write(h)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"solemne3_SO/node"
+	"solemne3_SO/sim"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runSimulate implementa el subcomando "sim": ejecuta un escenario en el
+// simulador de eventos discretos, sin sockets ni esperas reales
+func runSimulate(args []string) {
+	fs := flag.NewFlagSet("sim", flag.ExitOnError)
+	count := fs.Int("nodes", 3, "Cantidad de nodos simulados")
+	algo := fs.String("algo", "cristian", "Algoritmo de sincronización ("+strings.Join(sim.Algorithms, "|")+")")
+	rounds := fs.Int("rounds", 1000, "Rondas que ejecuta cada nodo")
+	interval := fs.Duration("interval", time.Second, "Tiempo virtual entre rondas")
+	latency := fs.String("latency", "uniform:1ms,20ms", "Distribución de latencia (fixed:d, uniform:min,max, normal:media,desv, exp:min,media)")
+	seed := fs.Uint64("seed", 1, "Semilla del generador aleatorio")
+	skews := fs.String("skew", "", "Desfase inicial de cada nodo separado por comas, ej: 0s,2s,-1.5s")
+	drifts := fs.String("drift", "", "Deriva de cada nodo en ppm separada por comas, ej: 0,50,-100")
+	leader := fs.Int("leader", -1, "Índice del único nodo que ejecuta rondas (-1 las ejecuta en todos, salvo con berkeley, que usa el nodo 0)")
+	trace := fs.Bool("trace", false, "Mostrar la traza completa de eventos")
+	fs.Parse(args)
+
+	dist, err := node.ParseLatency(*latency)
+	if err != nil {
+		fmt.Println("Error en --latency:", err)
+		os.Exit(1)
+	}
+	skewList, err := parseList(*skews, max(*count, 0), time.ParseDuration)
+	if err != nil {
+		fmt.Println("Error en --skew:", err)
+		os.Exit(1)
+	}
+	driftList, err := parseList(*drifts, max(*count, 0), func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+	if err != nil {
+		fmt.Println("Error en --drift:", err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	result, err := sim.Run(sim.Config{
+		Seed:      *seed,
+		Nodes:     *count,
+		Algorithm: *algo,
+		Rounds:    *rounds,
+		Interval:  *interval,
+		Latency:   dist,
+		Skews:     skewList,
+		Drifts:    driftList,
+		Leader:    *leader,
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	took := time.Since(start)
+
+	if *trace {
+		result.Trace.Write(os.Stdout)
+		fmt.Println()
+	}
+
+	fmt.Printf("Simulación de %d nodos con %s: %d rondas, latencia %s, semilla %d\n",
+		*count, *algo, *rounds, dist, *seed)
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "NODO\tDESFASE INI\tDERIVA\tDESFASE FINAL\tAJUSTES\tLAMPORT\t")
+	for i := range *count {
+		fmt.Fprintf(w, "n%d\t%s\t%sppm\t%s\t%d\t%d\t\n",
+			i, skewList[i], strconv.FormatFloat(driftList[i], 'f', -1, 64),
+			result.Offsets[i].Round(time.Microsecond), result.Adjustments[i], result.Lamport[i])
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Dispersión final:", result.Spread.Round(time.Microsecond))
+	fmt.Printf("Tiempo simulado: %s en %s (%d eventos, %d mensajes, %d rondas omitidas)\n",
+		result.Elapsed, took.Round(time.Microsecond), result.Events, result.Messages, result.Skipped)
+	fmt.Println("Resumen de la traza:", result.Trace.Digest())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// DefaultMaxSlew es la tasa de ajuste gradual por defecto en ppm (la de NTP).
+// Con ella el reloj no retrocede salvo que se indique --allow-backwards; las
+// correcciones hacia atrás mayores a --step-threshold se frenan a
+// node.BackwardSlew para que converjan en segundos. Un node.Node creado desde
+// código, en cambio, salta siempre si no configura MaxSlew.
+const DefaultMaxSlew = 500.0
+
+// slewOptions son las opciones de ajuste gradual del reloj, compartidas por el
+// nodo y el subcomando "cluster"
+type slewOptions struct {
+	maxSlew        *float64
+	stepThreshold  *time.Duration
+	allowBackwards *bool
+}
+
+// addSlewFlags registra las opciones de ajuste gradual en el conjunto de flags
+func addSlewFlags(fs *flag.FlagSet) slewOptions {
+	return slewOptions{
+		maxSlew:        fs.Float64("max-slew", DefaultMaxSlew, "Tasa máxima de ajuste gradual del reloj en ppm (0 ajusta con saltos, incluso hacia atrás)"),
+		stepThreshold:  fs.Duration("step-threshold", 128*time.Millisecond, "Con ajuste gradual, corrección a partir de la cual el reloj salta (0 nunca salta)"),
+		allowBackwards: fs.Bool("allow-backwards", false, "Con ajuste gradual, permite que los saltos mayores a --step-threshold retrocedan el reloj"),
+	}
+}
+
+// validate revisa que las opciones sean coherentes
+func (o slewOptions) validate() error {
+	if *o.maxSlew < 0 {
+		return errors.New("--max-slew no puede ser negativo")
+	}
+	if *o.stepThreshold < 0 {
+		return errors.New("--step-threshold no puede ser negativo")
+	}
+	return nil
+}
+
+// apply configura el ajuste del reloj del nodo
+func (o slewOptions) apply(n *node.Node) {
+	n.MaxSlew = *o.maxSlew
+	n.StepThreshold = *o.stepThreshold
+	n.AllowBackwards = *o.allowBackwards
+}
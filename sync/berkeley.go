@@ -1,25 +1,50 @@
 package sync
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"solemne3_SO/metrics"
 	"solemne3_SO/node" // Cambia por tu nombre real de módulo
 )
 
+// BerkeleyRound contiene los valores calculados en una ronda de Berkeley
+type BerkeleyRound struct {
+	ID          string                   // Identificador de la ronda
+	Diffs       map[string]time.Duration // Diferencia de cada nodo respecto al coordinador
+	Excluded    map[string]error         // Nodos que no participaron y el motivo
+	Average     time.Duration            // Diferencia promedio
+	Adjustments map[string]time.Duration // Ajuste enviado a cada nodo
+}
+
 // BerkeleySync inicia una sincronización desde un nodo coordinador hacia todos los nodos
-func BerkeleySync(coordinator *node.Node) {
-	fmt.Printf("[%s] Berkeley: Iniciando proceso de sincronizacion como coordinador\n", coordinator.Name)
+func BerkeleySync(coordinator *node.Node) (BerkeleyRound, error) {
+	round := BerkeleyRound{
+		ID:          newRoundID(),
+		Diffs:       make(map[string]time.Duration),
+		Excluded:    make(map[string]error),
+		Adjustments: make(map[string]time.Duration),
+	}
+	err := berkeleySync(coordinator, &round)
+	notifyBerkeley(coordinator, round, err)
+	return round, err
+}
+
+// berkeleySync realiza la ronda y completa su resultado
+func berkeleySync(coordinator *node.Node, round *BerkeleyRound) error {
+	log := coordinator.Logger.With("algorithm", "berkeley", "round", round.ID)
+	log.Debug("iniciando proceso de sincronización como coordinador")
 
-	var totalDiff time.Duration
-	var responses int
-	timeDiffs := make(map[string]time.Duration)
+	timeDiffs := round.Diffs
 
-	fmt.Printf("[%s] Berkeley: Solicitando hora actual a todos los nodos\n", coordinator.Name)
+	log.Debug("solicitando hora actual a todos los nodos")
 
 	// Enviar solicitud de hora a cada nodo
 	for _, peer := range coordinator.Peers {
@@ -27,136 +52,167 @@ func BerkeleySync(coordinator *node.Node) {
 			continue // Saltar a sí mismo
 		}
 
-		fmt.Printf("[%s] Berkeley: Conectando con nodo %s\n", coordinator.Name, peer)
+		log.Debug("conectando con nodo", "peer", peer)
 
-		conn, err := net.Dial("tcp", peer)
+		// Solicitar hora y recibir respuesta
+		start := coordinator.RealNow()
+		message, err := coordinator.Request(peer, "GET_TIME")
 		if err != nil {
-			fmt.Printf("[%s] Berkeley: ERROR - No se pudo conectar con %s: %v\n", coordinator.Name, peer, err)
-			continue
-		}
-
-		// Solicitar hora
-		_, err = fmt.Fprintf(conn, "GET_TIME\n")
-		if err != nil {
-			fmt.Printf("[%s] Berkeley: ERROR - No se pudo enviar solicitud a %s: %v\n", coordinator.Name, peer, err)
-			conn.Close()
-			continue
-		}
-
-		// Recibir respuesta
-		message, err := bufio.NewReader(conn).ReadString('\n')
-		conn.Close()
-		if err != nil {
-			fmt.Printf("[%s] Berkeley: ERROR - No se pudo leer respuesta de %s: %v\n", coordinator.Name, peer, err)
+			round.Excluded[peer] = fmt.Errorf("no se pudo obtener la hora: %w", err)
 			continue
 		}
+		metrics.SyncRTT.Observe(coordinator.RealNow().Sub(start).Seconds(), coordinator.Name, "berkeley")
 
 		// Parsear hora
-		remoteTime, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(message))
+		remoteTime, err := node.ParseTime(strings.TrimSpace(message))
 		if err != nil {
-			fmt.Printf("[%s] Berkeley: ERROR - Formato de hora inválido de %s: %s\n", coordinator.Name, peer, strings.TrimSpace(message))
+			round.Excluded[peer] = fmt.Errorf("formato de hora inválido: %q", strings.TrimSpace(message))
 			continue
 		}
 
 		// Calcular diferencia
-		diff := remoteTime.Sub(coordinator.GetClock())
+		diff := remoteTime.Sub(coordinator.TargetClock())
 		timeDiffs[peer] = diff
-		totalDiff += diff
-		responses++
+		metrics.ClockOffset.Set(diff.Seconds(), coordinator.Name, peer)
 
-		fmt.Printf("[%s] Berkeley: Recibido de %s - Hora: %s, Diferencia: %v\n",
-			coordinator.Name, peer, remoteTime.Format("15:04:05"), diff)
+		log.Debug("hora recibida", "peer", peer, "clock", remoteTime, "offset", diff)
+	}
+
+	if len(timeDiffs) == 0 {
+		metrics.SyncFailed(coordinator.Name, "berkeley")
+		return errors.New("no se pudo obtener respuesta de ningún nodo")
 	}
 
 	// Agregar la propia hora del coordinador
 	timeDiffs[coordinator.Address] = 0
-	totalDiff += 0
-	responses++
-
-	fmt.Printf("[%s] Berkeley: Hora propia del coordinador: %s\n",
-		coordinator.Name, coordinator.GetClock().Format("15:04:05"))
 
-	if responses == 0 {
-		fmt.Printf("[%s] Berkeley: ERROR - No se pudo obtener respuesta de ningún nodo\n", coordinator.Name)
-		return
-	}
+	log.Debug("hora propia del coordinador", "clock", coordinator.TargetClock())
 
-	// Calcular promedio de diferencias
-	avgDiff := time.Duration(int64(totalDiff) / int64(responses))
-	fmt.Printf("[%s] Berkeley: Calculando ajuste promedio basado en %d respuestas\n", coordinator.Name, responses)
-	fmt.Printf("[%s] Berkeley: Diferencia promedio calculada: %v\n", coordinator.Name, avgDiff)
+	// Calcular promedio de diferencias y el ajuste de cada nodo
+	round.Average, round.Adjustments = BerkeleyAdjustments(timeDiffs)
+	log.Debug("diferencia promedio calculada", "responses", len(timeDiffs), "average", round.Average)
 
 	// Enviar ajuste a cada nodo
-	fmt.Printf("[%s] Berkeley: Enviando ajustes a todos los nodos\n", coordinator.Name)
-
-	for peer, diff := range timeDiffs {
-		adjustment := avgDiff - diff
+	log.Debug("enviando ajustes a todos los nodos")
 
+	// Los ajustes se envían en orden fijo para que la ronda sea reproducible
+	var sendErrs []error
+	for _, peer := range slices.Sorted(maps.Keys(round.Adjustments)) {
+		adjustment := round.Adjustments[peer]
 		if peer == coordinator.Address {
 			// Ajustar su propio reloj
-			oldTime := coordinator.GetClock()
+			oldTime := coordinator.TargetClock()
 			newTime := oldTime.Add(adjustment)
 			coordinator.SetClock(newTime)
-			fmt.Printf("[%s] Berkeley: Ajuste propio - Hora anterior: %s, Hora nueva: %s, Ajuste: %v\n",
-				coordinator.Name, oldTime.Format("15:04:05"), newTime.Format("15:04:05"), adjustment)
+			coordinator.RecordOffset(coordinator.Address, "berkeley", adjustment)
+			metrics.ObserveAdjustment(coordinator.Name, "berkeley", adjustment)
+			log.Debug("ajuste propio aplicado", "offset", adjustment, "previous_clock", oldTime, "clock", newTime)
 			continue
 		}
 
-		fmt.Printf("[%s] Berkeley: Enviando ajuste a %s: %v\n", coordinator.Name, peer, adjustment)
+		log.Debug("enviando ajuste", "peer", peer, "offset", adjustment)
 
-		conn, err := net.Dial("tcp", peer)
-		if err != nil {
-			fmt.Printf("[%s] Berkeley: ERROR - No se pudo conectar para enviar ajuste a %s: %v\n", coordinator.Name, peer, err)
-			continue
+		message := "ADJUST_TIME:" + strconv.FormatFloat(adjustment.Seconds(), 'f', 6, 64)
+		if err := coordinator.SendMessage(peer, message); err != nil {
+			sendErrs = append(sendErrs, fmt.Errorf("no se pudo enviar ajuste a %s: %w", peer, err))
 		}
+	}
 
-		message := "ADJUST_TIME:" + strconv.FormatInt(int64(adjustment.Seconds()), 10) + "\n"
-		_, err = fmt.Fprintf(conn, message)
-		if err != nil {
-			fmt.Printf("[%s] Berkeley: ERROR - No se pudo enviar ajuste a %s: %v\n", coordinator.Name, peer, err)
-		} else {
-			fmt.Printf("[%s] Berkeley: Ajuste enviado exitosamente a %s\n", coordinator.Name, peer)
-		}
-		conn.Close()
+	if err := errors.Join(sendErrs...); err != nil {
+		metrics.SyncFailed(coordinator.Name, "berkeley")
+		return err
 	}
 
-	fmt.Printf("[%s] Berkeley: Proceso de sincronización completado\n", coordinator.Name)
+	log.Debug("proceso de sincronización completado")
+	metrics.SyncSucceeded(coordinator.Name, "berkeley")
+	return nil
+}
+
+// BerkeleyAdjustments calcula el promedio de las diferencias de hora respecto
+// al coordinador (que debe incluirse con diferencia cero) y el ajuste que
+// debe aplicar cada nodo para llegar a ese promedio
+func BerkeleyAdjustments(diffs map[string]time.Duration) (time.Duration, map[string]time.Duration) {
+	if len(diffs) == 0 {
+		return 0, map[string]time.Duration{}
+	}
+
+	var total time.Duration
+	for _, diff := range diffs {
+		total += diff
+	}
+	average := total / time.Duration(len(diffs))
+
+	adjustments := make(map[string]time.Duration, len(diffs))
+	for peer, diff := range diffs {
+		adjustments[peer] = average - diff
+	}
+	return average, adjustments
 }
 
 // HandleBerkeleyMessage interpreta los mensajes relacionados a Berkeley
 func HandleBerkeleyMessage(n *node.Node, message string, conn net.Conn) {
+	log := n.Logger.With("algorithm", "berkeley")
 	msg := strings.TrimSpace(message)
 
 	switch {
 	case msg == "GET_TIME":
-		currentTime := n.GetClock().Format("2006-01-02 15:04:05")
+		currentTime := node.FormatTime(n.TargetClock())
 		conn.Write([]byte(currentTime + "\n"))
-		fmt.Printf("[%s] Berkeley: Solicitud de hora recibida - Enviando: %s\n",
-			n.Name, currentTime)
+		log.Debug("solicitud de hora recibida", "clock", currentTime)
 
 	case strings.HasPrefix(msg, "ADJUST_TIME:"):
 		parts := strings.Split(msg, ":")
 		if len(parts) != 2 {
-			fmt.Printf("[%s] Berkeley: ERROR - Formato de ajuste inválido: %s\n", n.Name, msg)
+			log.Warn("formato de ajuste inválido", "message", msg)
 			return
 		}
 
-		adjustmentSec, err := strconv.ParseInt(parts[1], 10, 64)
+		adjustmentSec, err := strconv.ParseFloat(parts[1], 64)
 		if err != nil {
-			fmt.Printf("[%s] Berkeley: ERROR - Valor de ajuste inválido: %s\n", n.Name, parts[1])
+			log.Warn("valor de ajuste inválido", "value", parts[1])
 			return
 		}
 
-		oldTime := n.GetClock()
-		newTime := oldTime.Add(time.Duration(adjustmentSec) * time.Second)
+		oldTime := n.TargetClock()
+		newTime := oldTime.Add(time.Duration(adjustmentSec * float64(time.Second)))
 		n.SetClock(newTime)
+		n.RecordOffset("coordinador", "berkeley", newTime.Sub(oldTime))
+		metrics.ObserveAdjustment(n.Name, "berkeley", newTime.Sub(oldTime))
 
-		fmt.Printf("[%s] Berkeley: Ajuste recibido del coordinador\n", n.Name)
-		fmt.Printf("[%s] Berkeley: Hora anterior: %s\n", n.Name, oldTime.Format("15:04:05"))
-		fmt.Printf("[%s] Berkeley: Hora nueva: %s\n", n.Name, newTime.Format("15:04:05"))
-		fmt.Printf("[%s] Berkeley: Ajuste aplicado: %d segundos\n", n.Name, adjustmentSec)
+		log.Info("ajuste recibido del coordinador",
+			"offset", newTime.Sub(oldTime), "previous_clock", oldTime, "clock", newTime)
 
 	default:
-		fmt.Printf("[%s] Berkeley: Mensaje no reconocido: %s\n", n.Name, msg)
+		log.Warn("mensaje no reconocido", "message", msg)
 	}
 }
+
+func init() {
+	Register("berkeley", func() Synchronizer { return &berkeleySynchronizer{} })
+}
+
+// berkeleySynchronizer ejecuta rondas de Berkeley con el nodo como coordinador
+type berkeleySynchronizer struct {
+	node *node.Node
+}
+
+func (s *berkeleySynchronizer) Name() string { return "berkeley" }
+
+// Coordinator marca a Berkeley como algoritmo de un solo coordinador
+func (s *berkeleySynchronizer) Coordinator() {}
+
+func (s *berkeleySynchronizer) Start(ctx context.Context, n *node.Node) error {
+	s.node = n
+	return nil
+}
+
+// SyncOnce ejecuta una ronda completa como coordinador
+func (s *berkeleySynchronizer) SyncOnce(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := BerkeleySync(s.node)
+	return err
+}
+
+func (s *berkeleySynchronizer) Stop() error { return nil }
@@ -1,118 +1,156 @@
 package sync
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"time"
 
+	"solemne3_SO/metrics"
 	"solemne3_SO/node" // Reemplaza con el nombre real de tu módulo
 )
 
+// CristianResult contiene los valores calculados en una sincronización de Cristian
+type CristianResult struct {
+	Round      string        // Identificador de la ronda
+	Peer       string        // Servidor consultado
+	Offset     time.Duration // Ajuste aplicado al reloj local
+	RTT        time.Duration // Tiempo de ida y vuelta de la solicitud
+	ErrorBound time.Duration // Cota del error de la estimación (RTT/2 más la incertidumbre del servidor)
+	ServerTime time.Time     // Hora informada por el servidor
+}
+
 // CristianSync permite sincronizar el reloj de un cliente con un servidor
-func CristianSync(client *node.Node, serverAddress string) {
-	fmt.Printf("[%s] Cristian: Iniciando sincronización con servidor %s\n", client.Name, serverAddress)
+func CristianSync(client *node.Node, serverAddress string) (CristianResult, error) {
+	result := CristianResult{Round: newRoundID(), Peer: serverAddress}
+	err := cristianSync(client, &result)
+	notifyCristian(client, result, err)
+	return result, err
+}
+
+// cristianSync realiza la sincronización y completa el resultado
+func cristianSync(client *node.Node, result *CristianResult) error {
+	log := client.Logger.With("algorithm", "cristian", "peer", result.Peer, "round", result.Round)
+	log.Debug("iniciando sincronización con servidor")
 
 	// Obtener hora actual del cliente antes de la sincronización
 	initialTime := client.GetClock()
-	fmt.Printf("[%s] Cristian: Hora inicial del cliente: %s\n", client.Name, initialTime.Format("15:04:05"))
-
-	// Marca de tiempo antes de enviar la solicitud
-	T0 := time.Now()
-	fmt.Printf("[%s] Cristian: Enviando solicitud de tiempo al servidor\n", client.Name)
+	log.Debug("hora inicial del cliente", "clock", initialTime)
 
-	// Conectar al servidor
-	conn, err := net.Dial("tcp", serverAddress)
+	// Consultar la hora del servidor midiendo el tiempo de ida y vuelta
+	serverTime, serverBound, roundTrip, err := consultarHora(client, result.Peer)
 	if err != nil {
-		fmt.Printf("[%s] Cristian: ERROR - No se pudo conectar al servidor %s: %v\n", client.Name, serverAddress, err)
-		return
+		metrics.SyncFailed(client.Name, "cristian")
+		return err
 	}
-	defer conn.Close()
-
-	fmt.Printf("[%s] Cristian: Conexión establecida con el servidor\n", client.Name)
+	log.Debug("respuesta recibida del servidor", "server_time", serverTime)
 
-	// Enviar solicitud
-	_, err = fmt.Fprintf(conn, "TIME_REQUEST\n")
-	if err != nil {
-		fmt.Printf("[%s] Cristian: ERROR - No se pudo enviar solicitud al servidor: %v\n", client.Name, err)
-		return
-	}
+	// Calcular tiempo estimado del servidor al momento de recibir la respuesta
+	estimatedTime, estimatedLatency := CristianEstimate(serverTime, roundTrip)
+	bound := estimatedLatency + serverBound
+
+	log.Debug("hora del servidor ajustada por latencia", "rtt", roundTrip, "latency", estimatedLatency,
+		"server_time", serverTime, "server_bound", serverBound, "estimated_time", estimatedTime)
+
+	// Calcular diferencia con el reloj local al recibir la respuesta
+	timeDifference := estimatedTime.Sub(client.GetClock())
+
+	// Ajustar reloj del cliente con la cota de error de la estimación, que
+	// incluye la del reloj del servidor
+	client.SyncClock(estimatedTime, bound)
+	client.RecordOffset(result.Peer, "cristian", timeDifference)
+
+	metrics.SyncRTT.Observe(roundTrip.Seconds(), client.Name, "cristian")
+	metrics.ClockOffset.Set(timeDifference.Seconds(), client.Name, result.Peer)
+	metrics.ObserveAdjustment(client.Name, "cristian", timeDifference)
+	metrics.SyncSucceeded(client.Name, "cristian")
+
+	result.Offset = timeDifference
+	result.RTT = roundTrip
+	result.ErrorBound = bound
+	result.ServerTime = serverTime
+	return nil
+}
 
-	// Recibir respuesta
-	buffer := make([]byte, 128)
-	n, err := conn.Read(buffer)
+// consultarHora solicita la hora a un servidor y retorna la hora informada,
+// la incertidumbre del reloj del servidor y el tiempo de ida y vuelta de la solicitud
+func consultarHora(client *node.Node, serverAddress string) (time.Time, time.Duration, time.Duration, error) {
+	T0 := client.RealNow()
+	reply, err := client.Request(serverAddress, "TIME_REQUEST")
 	if err != nil {
-		fmt.Printf("[%s] Cristian: ERROR - No se pudo leer respuesta del servidor: %v\n", client.Name, err)
-		return
+		return time.Time{}, 0, 0, fmt.Errorf("no se pudo obtener la hora del servidor %s: %w", serverAddress, err)
 	}
+	T1 := client.RealNow()
 
-	// Marca de tiempo al recibir respuesta
-	T1 := time.Now()
-
-	// Procesar respuesta
-	reply := strings.TrimSpace(string(buffer[:n]))
-	fmt.Printf("[%s] Cristian: Respuesta recibida del servidor: %s\n", client.Name, reply)
-
-	serverTime, err := time.Parse("2006-01-02 15:04:05", reply)
+	serverTime, serverBound, err := node.ParseTimeReply(reply)
 	if err != nil {
-		fmt.Printf("[%s] Cristian: ERROR - Formato de hora inválido del servidor: %s\n", client.Name, reply)
-		return
+		return time.Time{}, 0, 0, fmt.Errorf("formato de hora inválido del servidor %s: %q", serverAddress, reply)
 	}
+	return serverTime, serverBound, T1.Sub(T0), nil
+}
 
-	// Calcular retardo estimado
-	roundTrip := T1.Sub(T0)
-	estimatedLatency := roundTrip / 2
-
-	fmt.Printf("[%s] Cristian: Tiempo de ida y vuelta (RTT): %v\n", client.Name, roundTrip)
-	fmt.Printf("[%s] Cristian: Latencia estimada: %v\n", client.Name, estimatedLatency)
-
-	// Calcular tiempo estimado del servidor al momento de recibir la respuesta
-	estimatedTime := serverTime.Add(estimatedLatency)
-
-	fmt.Printf("[%s] Cristian: Hora del servidor: %s\n", client.Name, serverTime.Format("15:04:05"))
-	fmt.Printf("[%s] Cristian: Hora estimada ajustada por latencia: %s\n", client.Name, estimatedTime.Format("15:04:05"))
-
-	// Calcular diferencia entre relojes
-	timeDifference := estimatedTime.Sub(initialTime)
-	fmt.Printf("[%s] Cristian: Diferencia entre relojes: %v\n", client.Name, timeDifference)
-
-	// Ajustar reloj del cliente
-	client.SetClock(estimatedTime)
-
-	finalTime := client.GetClock()
-	fmt.Printf("[%s] Cristian: Sincronización completada exitosamente\n", client.Name)
-	fmt.Printf("[%s] Cristian: Hora anterior: %s\n", client.Name, initialTime.Format("15:04:05"))
-	fmt.Printf("[%s] Cristian: Hora nueva: %s\n", client.Name, finalTime.Format("15:04:05"))
-	fmt.Printf("[%s] Cristian: Ajuste aplicado: %v\n", client.Name, timeDifference)
-
-	// Mostrar resumen de la sincronización
-	if timeDifference > 0 {
-		fmt.Printf("[%s] Cristian: Reloj adelantado en %v\n", client.Name, timeDifference)
-	} else if timeDifference < 0 {
-		fmt.Printf("[%s] Cristian: Reloj atrasado en %v\n", client.Name, -timeDifference)
-	} else {
-		fmt.Printf("[%s] Cristian: Reloj ya estaba sincronizado\n", client.Name)
-	}
+// CristianEstimate calcula la hora del servidor al momento de recibir la
+// respuesta, compensando la mitad del tiempo de ida y vuelta. Retorna también
+// la cota del error de la estimación (RTT/2).
+func CristianEstimate(serverTime time.Time, rtt time.Duration) (time.Time, time.Duration) {
+	latency := rtt / 2
+	return serverTime.Add(latency), latency
 }
 
 // HandleTimeRequest procesa solicitudes de hora de otros nodos
 func HandleTimeRequest(n *node.Node, message string, conn net.Conn) {
+	log := n.Logger.With("algorithm", "cristian")
+
 	if strings.TrimSpace(message) != "TIME_REQUEST" {
-		fmt.Printf("[%s] Cristian: Mensaje no reconocido: %s\n", n.Name, strings.TrimSpace(message))
+		log.Warn("mensaje no reconocido", "message", strings.TrimSpace(message))
 		return
 	}
 
-	fmt.Printf("[%s] Cristian: Solicitud de tiempo recibida de un cliente\n", n.Name)
+	log.Debug("solicitud de tiempo recibida de un cliente")
 
-	currentTime := n.GetClock()
-	timeString := currentTime.Format("2006-01-02 15:04:05")
+	reply := n.TimeReply()
 
-	_, err := conn.Write([]byte(timeString + "\n"))
+	_, err := conn.Write([]byte(reply + "\n"))
 	if err != nil {
-		fmt.Printf("[%s] Cristian: ERROR - No se pudo enviar respuesta al cliente: %v\n", n.Name, err)
+		log.Error("no se pudo enviar respuesta al cliente", "error", err)
 		return
 	}
 
-	fmt.Printf("[%s] Cristian: Tiempo enviado al cliente: %s\n", n.Name, currentTime.Format("15:04:05"))
-	fmt.Printf("[%s] Cristian: Respuesta enviada exitosamente\n", n.Name)
+	log.Debug("tiempo enviado al cliente", "clock", reply)
+}
+
+func init() {
+	Register("cristian", func() Synchronizer { return &cristianSynchronizer{} })
+}
+
+// cristianSynchronizer sincroniza el nodo consultando a cada par como servidor de hora
+type cristianSynchronizer struct {
+	node *node.Node
+}
+
+func (s *cristianSynchronizer) Name() string { return "cristian" }
+
+func (s *cristianSynchronizer) Start(ctx context.Context, n *node.Node) error {
+	s.node = n
+	return nil
 }
+
+// SyncOnce consulta a todos los pares en orden. Cada respuesta ajusta el
+// reloj, por lo que el resultado es el de la última consulta exitosa; para
+// combinar las respuestas de todos los pares está la estrategia marzullo.
+func (s *cristianSynchronizer) SyncOnce(ctx context.Context) error {
+	var errs []error
+	for _, peer := range peersOf(s.node) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := CristianSync(s.node, peer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *cristianSynchronizer) Stop() error { return nil }
@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// HLCMaxDrift es la diferencia máxima tolerada entre la marca de un mensaje y
+// el reloj físico local (0 no limita)
+var HLCMaxDrift = time.Second
+
+// ErrHLCDrift indica que un mensaje trae una marca demasiado adelantada respecto al reloj local
+var ErrHLCDrift = errors.New("marca HLC fuera de la deriva máxima tolerada")
+
+// MarcaHLC es una marca de reloj lógico híbrido: la mayor hora física
+// conocida (L) y un contador lógico (C) que ordena los eventos con igual L
+type MarcaHLC struct {
+	L int64 `json:"l"` // Hora física en nanosegundos desde la época Unix
+	C int   `json:"c"`
+}
+
+// Time retorna la componente física de la marca
+func (m MarcaHLC) Time() time.Time {
+	return time.Unix(0, m.L).UTC()
+}
+
+// Before indica si la marca ocurrió antes que otra
+func (m MarcaHLC) Before(otra MarcaHLC) bool {
+	if m.L != otra.L {
+		return m.L < otra.L
+	}
+	return m.C < otra.C
+}
+
+func (m MarcaHLC) String() string {
+	return node.FormatTime(m.Time()) + "/" + strconv.Itoa(m.C)
+}
+
+// RelojHLC es un reloj lógico híbrido (Kulkarni et al.): respeta la
+// causalidad como el reloj de Lamport y su componente física se mantiene
+// cerca del reloj sincronizado del nodo
+type RelojHLC struct {
+	mu       gosync.Mutex
+	fisico   func() time.Time
+	actual   MarcaHLC
+	MaxDrift time.Duration // Deriva máxima tolerada en los mensajes recibidos (0 no limita)
+}
+
+// NewRelojHLC crea un reloj híbrido sobre el reloj sincronizado del nodo
+func NewRelojHLC(n *node.Node) *RelojHLC {
+	return &RelojHLC{fisico: n.GetClock, MaxDrift: HLCMaxDrift}
+}
+
+// Now registra un evento local o un envío y retorna su marca
+func (r *RelojHLC) Now() MarcaHLC {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pt := r.fisico().UnixNano()
+	if pt > r.actual.L {
+		r.actual = MarcaHLC{L: pt}
+	} else {
+		r.actual.C++
+	}
+	return r.actual
+}
+
+// Update registra la recepción de un mensaje con la marca remota y retorna
+// la nueva marca local. Si la marca remota supera el reloj físico local en
+// más de MaxDrift el mensaje se rechaza y el reloj no cambia.
+func (r *RelojHLC) Update(remota MarcaHLC) (MarcaHLC, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pt := r.fisico().UnixNano()
+	if adelanto := time.Duration(remota.L - pt); r.MaxDrift > 0 && adelanto > r.MaxDrift {
+		return r.actual, fmt.Errorf("%w: adelantada %s (máximo %s)", ErrHLCDrift, adelanto, r.MaxDrift)
+	}
+
+	anterior := r.actual
+	l := max(anterior.L, remota.L, pt)
+	switch {
+	case l == anterior.L && l == remota.L:
+		r.actual = MarcaHLC{L: l, C: max(anterior.C, remota.C) + 1}
+	case l == anterior.L:
+		r.actual = MarcaHLC{L: l, C: anterior.C + 1}
+	case l == remota.L:
+		r.actual = MarcaHLC{L: l, C: remota.C + 1}
+	default:
+		r.actual = MarcaHLC{L: l}
+	}
+	return r.actual, nil
+}
+
+// Get retorna la última marca sin registrar un evento
+func (r *RelojHLC) Get() MarcaHLC {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.actual
+}
+
+func init() {
+	Register("hlc", func() Synchronizer { return &hlcSynchronizer{} })
+}
+
+// hlcSynchronizer intercambia mensajes con marca de reloj híbrido entre los pares
+type hlcSynchronizer struct {
+	node  *node.Node
+	reloj *RelojHLC
+}
+
+func (s *hlcSynchronizer) Name() string { return "hlc" }
+
+// Start crea el reloj híbrido y registra el manejador de mensajes HLC
+func (s *hlcSynchronizer) Start(ctx context.Context, n *node.Node) error {
+	s.node = n
+	s.reloj = NewRelojHLC(n)
+	n.RegisterHandler("HLC:", func(message string, conn net.Conn) {
+		s.handle(message)
+	})
+	return nil
+}
+
+// SyncOnce envía un mensaje con la marca híbrida a cada par
+func (s *hlcSynchronizer) SyncOnce(ctx context.Context) error {
+	var errs []error
+	for _, peer := range peersOf(s.node) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		marca := s.reloj.Now()
+		message := fmt.Sprintf("HLC:%d:%d:Hola desde %s", marca.L, marca.C, s.node.Name)
+		if err := s.node.SendMessage(peer, message); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.node.Logger.Info("mensaje enviado", "algorithm", "hlc", "peer", peer, "hlc", marca)
+	}
+	return errors.Join(errs...)
+}
+
+// handle procesa un mensaje "HLC:l:c:contenido"
+func (s *hlcSynchronizer) handle(message string) {
+	parts := strings.SplitN(message, ":", 4)
+	if len(parts) != 4 {
+		return
+	}
+	l, errL := strconv.ParseInt(parts[1], 10, 64)
+	c, errC := strconv.Atoi(parts[2])
+	if errL != nil || errC != nil {
+		s.node.Logger.Warn("marca HLC inválida", "message", message)
+		return
+	}
+	remota := MarcaHLC{L: l, C: c}
+
+	marca, err := s.reloj.Update(remota)
+	if err != nil {
+		s.node.Logger.Warn("mensaje rechazado", "algorithm", "hlc", "remote_hlc", remota, "error", err)
+		return
+	}
+	s.node.Logger.Info("mensaje recibido", "algorithm", "hlc", "content", parts[3],
+		"remote_hlc", remota, "hlc", marca)
+}
+
+// Stop elimina el manejador de mensajes HLC
+func (s *hlcSynchronizer) Stop() error {
+	s.node.UnregisterHandler("HLC:")
+	return nil
+}
@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// relojFijo crea un reloj híbrido cuyo reloj físico se controla con la función retornada
+func relojFijo(inicio time.Time) (*RelojHLC, func(time.Duration)) {
+	ahora := inicio
+	r := &RelojHLC{fisico: func() time.Time { return ahora }, MaxDrift: time.Second}
+	return r, func(d time.Duration) { ahora = ahora.Add(d) }
+}
+
+func TestHLCSend(t *testing.T) {
+	inicio := time.Unix(1000, 0)
+	r, avanzar := relojFijo(inicio)
+
+	m1 := r.Now()
+	if m1 != (MarcaHLC{L: inicio.UnixNano()}) {
+		t.Fatalf("primera marca = %v", m1)
+	}
+	// Sin avance del reloj físico crece el contador
+	m2 := r.Now()
+	if m2.L != m1.L || m2.C != 1 || !m1.Before(m2) {
+		t.Errorf("segunda marca = %v", m2)
+	}
+	// Con avance el contador vuelve a cero
+	avanzar(time.Millisecond)
+	m3 := r.Now()
+	if m3.L != inicio.Add(time.Millisecond).UnixNano() || m3.C != 0 || !m2.Before(m3) {
+		t.Errorf("tercera marca = %v", m3)
+	}
+}
+
+func TestHLCReceive(t *testing.T) {
+	inicio := time.Unix(1000, 0)
+	r, avanzar := relojFijo(inicio)
+	r.Now()
+
+	// Una marca remota adelantada (dentro de MaxDrift) se adopta
+	remota := MarcaHLC{L: inicio.Add(500 * time.Millisecond).UnixNano(), C: 3}
+	m, err := r.Update(remota)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != (MarcaHLC{L: remota.L, C: 4}) || !remota.Before(m) {
+		t.Errorf("marca tras recibir = %v", m)
+	}
+
+	// Los envíos siguientes quedan después de la recepción aunque el reloj
+	// físico siga atrasado
+	avanzar(time.Millisecond)
+	if envio := r.Now(); envio != (MarcaHLC{L: remota.L, C: 5}) {
+		t.Errorf("marca de envío = %v", envio)
+	}
+
+	// Con igual L se toma el mayor contador
+	if m, _ := r.Update(MarcaHLC{L: remota.L, C: 9}); m != (MarcaHLC{L: remota.L, C: 10}) {
+		t.Errorf("marca con igual L = %v", m)
+	}
+
+	// Una marca remota atrasada no cambia L
+	if m, _ := r.Update(MarcaHLC{L: inicio.UnixNano(), C: 50}); m != (MarcaHLC{L: remota.L, C: 11}) {
+		t.Errorf("marca tras una remota atrasada = %v", m)
+	}
+}
+
+func TestHLCRejectsDrift(t *testing.T) {
+	inicio := time.Unix(1000, 0)
+	r, _ := relojFijo(inicio)
+	antes := r.Now()
+
+	_, err := r.Update(MarcaHLC{L: inicio.Add(2 * time.Second).UnixNano()})
+	if !errors.Is(err, ErrHLCDrift) {
+		t.Fatalf("error = %v, se esperaba ErrHLCDrift", err)
+	}
+	if r.Get() != antes {
+		t.Errorf("el reloj cambió con una marca rechazada: %v", r.Get())
+	}
+}
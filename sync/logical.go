@@ -1,18 +1,42 @@
 package sync
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	gosync "sync"
 
+	"solemne3_SO/metrics"
 	"solemne3_SO/node"
 )
 
 // RelojLógico almacena el valor entero del reloj Lamport
 type RelojLógico struct {
+	mu    gosync.Mutex
 	Valor int
 }
 
+var (
+	relojesMu gosync.Mutex
+	relojes   = make(map[*node.Node]*RelojLógico)
+)
+
+// RelojDeNodo retorna el reloj lógico de Lamport de un nodo, creándolo si no existe.
+// Todos los algoritmos que usan Lamport sobre un mismo nodo comparten este reloj.
+func RelojDeNodo(n *node.Node) *RelojLógico {
+	relojesMu.Lock()
+	defer relojesMu.Unlock()
+	reloj, ok := relojes[n]
+	if !ok {
+		reloj = NewRelojLogico()
+		relojes[n] = reloj
+	}
+	return reloj
+}
+
 // NewRelojLogico inicializa el reloj lógico
 func NewRelojLogico() *RelojLógico {
 	return &RelojLógico{Valor: 0}
@@ -20,11 +44,15 @@ func NewRelojLogico() *RelojLógico {
 
 // Incrementa aumenta el contador local antes de un evento
 func (r *RelojLógico) Incrementa() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.Valor++
 }
 
 // Sincroniza actualiza el reloj con otro valor recibido
 func (r *RelojLógico) Sincroniza(valorRemoto int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if valorRemoto > r.Valor {
 		r.Valor = valorRemoto
 	}
@@ -33,17 +61,23 @@ func (r *RelojLógico) Sincroniza(valorRemoto int) {
 
 // Get retorna el valor actual del reloj
 func (r *RelojLógico) Get() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return r.Valor
 }
 
 // EnviarMensajeLogico envía un mensaje con el reloj lógico actual
-func EnviarMensajeLogico(from *node.Node, to string, reloj *RelojLógico, contenido string) {
+func EnviarMensajeLogico(from *node.Node, to string, reloj *RelojLógico, contenido string) error {
 	reloj.Incrementa()
 
 	message := fmt.Sprintf("LAMPORT:%d:%s", reloj.Get(), contenido)
-	from.SendMessage(to, message)
+	if err := from.SendMessage(to, message); err != nil {
+		return err
+	}
 
-	fmt.Printf("[%s] Envió mensaje a %s con reloj lógico %d\n", from.Name, to, reloj.Get())
+	metrics.LamportClock.Set(float64(reloj.Get()), from.Name)
+	from.Logger.Info("mensaje enviado", "algorithm", "logical", "peer", to, "lamport", reloj.Get())
+	return nil
 }
 
 // HandleLamportMessage procesa un mensaje con reloj lógico Lamport
@@ -59,7 +93,50 @@ func HandleLamportMessage(from *node.Node, reloj *RelojLógico, message string)
 	}
 
 	reloj.Sincroniza(valorRemoto)
+	metrics.LamportClock.Set(float64(reloj.Get()), from.Name)
+
+	from.Logger.Info("mensaje recibido", "algorithm", "logical", "content", parts[2],
+		"remote_lamport", valorRemoto, "lamport", reloj.Get())
+}
+
+func init() {
+	Register("logical", func() Synchronizer { return &logicalSynchronizer{} })
+}
+
+// logicalSynchronizer intercambia mensajes con marca de Lamport entre los pares
+type logicalSynchronizer struct {
+	node  *node.Node
+	reloj *RelojLógico
+}
+
+func (s *logicalSynchronizer) Name() string { return "logical" }
+
+// Start registra el manejador de mensajes LAMPORT en el nodo
+func (s *logicalSynchronizer) Start(ctx context.Context, n *node.Node) error {
+	s.node = n
+	s.reloj = RelojDeNodo(n)
+	n.RegisterHandler("LAMPORT:", func(message string, conn net.Conn) {
+		HandleLamportMessage(n, s.reloj, message)
+	})
+	return nil
+}
+
+// SyncOnce envía un mensaje con el reloj lógico a cada par
+func (s *logicalSynchronizer) SyncOnce(ctx context.Context) error {
+	var errs []error
+	for _, peer := range peersOf(s.node) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := EnviarMensajeLogico(s.node, peer, s.reloj, "Hola desde "+s.node.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
 
-	fmt.Printf("[%s] Recibió mensaje: '%s' con reloj lógico remoto %d, nuevo reloj local: %d\n",
-		from.Name, parts[2], valorRemoto, reloj.Get())
+// Stop elimina el manejador de mensajes LAMPORT
+func (s *logicalSynchronizer) Stop() error {
+	s.node.UnregisterHandler("LAMPORT:")
+	return nil
 }
@@ -0,0 +1,393 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/metrics"
+	"solemne3_SO/node"
+)
+
+// MaekawaQuorum retorna el conjunto de votación de un nodo: los nodos de su
+// fila y de su columna en una grilla de ⌈√N⌉ columnas armada con las
+// direcciones en orden. Dos conjuntos cualesquiera tienen al menos un nodo en
+// común, aunque la última fila esté incompleta.
+func MaekawaQuorum(addresses []string, self string) []string {
+	i := slices.Index(addresses, self)
+	if i < 0 {
+		return nil
+	}
+	cols := int(math.Ceil(math.Sqrt(float64(len(addresses)))))
+	fila, columna := i/cols, i%cols
+
+	var quorum []string
+	for j, address := range addresses {
+		if j/cols == fila || j%cols == columna {
+			quorum = append(quorum, address)
+		}
+	}
+	return quorum
+}
+
+// mensajeMK es un mensaje de Maekawa pendiente de enviar
+type mensajeMK struct {
+	To      string
+	Message string
+}
+
+// Maekawa implementa la exclusión mutua de Maekawa: un nodo entra a la
+// sección crítica cuando obtiene el voto (LOCKED) de todo su conjunto de
+// votación, y cada nodo vota por una sola solicitud a la vez. La prioridad la
+// da la marca de Lamport de la solicitud. Para evitar interbloqueos, el
+// votante que recibe una solicitud más prioritaria que la votada envía
+// INQUIRE, las menos prioritarias reciben FAILED, y el solicitante que ya
+// recibió FAILED devuelve los votos consultados con RELINQUISH. Cada entrada
+// cuesta entre 3(K-1) y 5(K-1) mensajes, con K el tamaño del conjunto de
+// votación (cerca de 2√N).
+//
+// No supone canales FIFO, porque cada mensaje viaja por su propia conexión y
+// puede adelantarse a otro. Cada mensaje lleva la marca de la solicitud a la
+// que se refiere y se descarta si ya no corresponde a la solicitud en curso
+// (o al voto dado, en el votante). Un INQUIRE que llega antes que el voto se
+// recuerda en consultas y se responde al recibir el voto si ya hubo FAILED, y
+// un FAILED que llega después del voto del mismo votante solo hace que se
+// devuelvan los votos consultados. RELINQUISH no puede adelantarse a la
+// solicitud, porque se envía después de recibir su voto, pero RELEASE sí: una
+// solicitud cancelada libera a todo el conjunto, incluso a los votantes a los
+// que la solicitud aún no llega. Por eso el votante recuerda la marca liberada
+// y descarta la solicitud atrasada, y el solicitante responde con RELEASE un
+// voto que ya no corresponde a la solicitud en curso.
+type Maekawa struct {
+	node  *node.Node
+	reloj *RelojLógico
+	mutexStats
+
+	mu gosync.Mutex
+
+	// Estado como solicitante
+	estado    int
+	marca     int             // Marca de Lamport de la solicitud en curso
+	votos     map[string]bool // Votantes que dieron su voto a la solicitud en curso
+	fallido   bool            // Algún votante respondió FAILED
+	consultas map[string]bool // INQUIRE recibidos que aún no se responden
+	listo     chan struct{}   // Se cierra al obtener todos los votos
+
+	// Estado como votante
+	ultimas    map[string]int // Marca de la última solicitud recibida (o liberada) de cada nodo
+	voto       solicitudRA    // Solicitud que tiene el voto (From vacío si no hay)
+	consultado bool           // Se envió INQUIRE por el voto actual
+	cola       []solicitudRA  // Solicitudes que esperan el voto, por prioridad
+}
+
+// NewMaekawa crea la exclusión mutua de Maekawa de un nodo y registra los
+// manejadores de sus mensajes
+func NewMaekawa(n *node.Node) *Maekawa {
+	mk := &Maekawa{
+		node:       n,
+		reloj:      RelojDeNodo(n),
+		mutexStats: mutexStats{node: n, algorithm: "maekawa"},
+		ultimas:    make(map[string]int),
+	}
+	for _, prefix := range mensajesMaekawa {
+		n.RegisterHandler(prefix+":", func(message string, conn net.Conn) {
+			mk.handle(message)
+		})
+	}
+	return mk
+}
+
+// mensajesMaekawa son los tipos de mensaje del algoritmo
+var mensajesMaekawa = []string{"MK_REQUEST", "MK_LOCKED", "MK_FAILED", "MK_INQUIRE", "MK_RELINQUISH", "MK_RELEASE"}
+
+func (mk *Maekawa) Name() string { return "maekawa" }
+
+// Quorum retorna el conjunto de votación del nodo
+func (mk *Maekawa) Quorum() []string {
+	return MaekawaQuorum(miembros(mk.node), mk.node.Address)
+}
+
+// Lock pide el voto a todo el conjunto de votación y espera recibirlos todos.
+// Si ctx se cancela antes, se liberan los votos obtenidos.
+func (mk *Maekawa) Lock(ctx context.Context) error {
+	start := time.Now()
+
+	mk.mu.Lock()
+	if mk.estado != liberado {
+		mk.mu.Unlock()
+		return errors.New("la sección crítica ya fue solicitada por este nodo")
+	}
+	mk.reloj.Incrementa()
+	mk.estado = buscando
+	mk.marca = mk.reloj.Get()
+	mk.votos = make(map[string]bool)
+	mk.consultas = make(map[string]bool)
+	mk.fallido = false
+	mk.listo = make(chan struct{})
+	marca, listo := mk.marca, mk.listo
+	salida := mk.aTodos("MK_REQUEST")
+	mk.mu.Unlock()
+
+	metrics.LamportClock.Set(float64(marca), mk.node.Name)
+	mk.enviar(salida)
+
+	select {
+	case <-listo:
+		wait := time.Since(start)
+		mk.entrada(wait)
+		mk.node.Logger.Debug("sección crítica obtenida", "algorithm", "maekawa", "lamport", marca, "wait", wait)
+		return nil
+	case <-ctx.Done():
+		mk.salir()
+		return ctx.Err()
+	}
+}
+
+// Unlock sale de la sección crítica y libera el voto de todo el conjunto
+func (mk *Maekawa) Unlock() error {
+	mk.mu.Lock()
+	estado := mk.estado
+	mk.mu.Unlock()
+	if estado != tomado {
+		return errors.New("el nodo no está en la sección crítica")
+	}
+	mk.salir()
+	return nil
+}
+
+// Close elimina los manejadores de mensajes de Maekawa
+func (mk *Maekawa) Close() {
+	for _, prefix := range mensajesMaekawa {
+		mk.node.UnregisterHandler(prefix + ":")
+	}
+}
+
+// salir vuelve al estado liberado y envía RELEASE a todo el conjunto
+func (mk *Maekawa) salir() {
+	mk.mu.Lock()
+	mk.estado = liberado
+	salida := mk.aTodos("MK_RELEASE")
+	mk.mu.Unlock()
+	mk.enviar(salida)
+}
+
+// handle procesa un mensaje de Maekawa, como votante o como solicitante
+func (mk *Maekawa) handle(message string) {
+	s, ok := parseMensajeRA(message)
+	if !ok {
+		mk.node.Logger.Warn("mensaje de Maekawa inválido", "message", message)
+		return
+	}
+	if !slices.Contains(miembros(mk.node), s.From) {
+		// Un nodo ajeno podría votar o retener votos en nombre de otro
+		mk.node.Logger.Warn("mensaje de Maekawa de un nodo desconocido", "from", s.From)
+		return
+	}
+	tipo, _, _ := strings.Cut(message, ":")
+
+	mk.mu.Lock()
+	var salida []mensajeMK
+	switch tipo {
+	case "MK_REQUEST":
+		salida = mk.solicitud(s)
+	case "MK_RELINQUISH":
+		salida = mk.cesion(s)
+	case "MK_RELEASE":
+		salida = mk.liberacion(s)
+	case "MK_LOCKED":
+		salida = mk.votado(s)
+	case "MK_FAILED":
+		salida = mk.fallo(s)
+	case "MK_INQUIRE":
+		salida = mk.consulta(s)
+	}
+	mk.mu.Unlock()
+
+	mk.enviar(salida)
+}
+
+// solicitud vota por la solicitud si el voto está libre; si no, la encola y
+// consulta al votado (INQUIRE) o avisa al solicitante que debe esperar (FAILED).
+// Debe llamarse con mu tomado, como las demás funciones de los mensajes.
+func (mk *Maekawa) solicitud(s solicitudRA) []mensajeMK {
+	if s.Timestamp <= mk.ultimas[s.From] {
+		// Solicitud duplicada: las marcas de un mismo nodo siempre crecen
+		return nil
+	}
+	mk.ultimas[s.From] = s.Timestamp
+	mk.reloj.Sincroniza(s.Timestamp)
+	metrics.LamportClock.Set(float64(mk.reloj.Get()), mk.node.Name)
+
+	if mk.voto.From == "" {
+		mk.voto = s
+		mk.consultado = false
+		return []mensajeMK{mk.armar("MK_LOCKED", s.From, s.Timestamp)}
+	}
+
+	anterior := slices.Clone(mk.cola[:min(1, len(mk.cola))])
+	mk.encolar(s)
+	if mk.cola[0] != s || !precedeSolicitud(s, mk.voto) {
+		return []mensajeMK{mk.armar("MK_FAILED", s.From, s.Timestamp)}
+	}
+
+	// La nueva solicitud es la más prioritaria: la que encabezaba la cola debe esperar
+	var salida []mensajeMK
+	for _, a := range anterior {
+		salida = append(salida, mk.armar("MK_FAILED", a.From, a.Timestamp))
+	}
+	if !mk.consultado {
+		mk.consultado = true
+		salida = append(salida, mk.armar("MK_INQUIRE", mk.voto.From, mk.voto.Timestamp))
+	}
+	return salida
+}
+
+// cesion recupera el voto devuelto con RELINQUISH y lo da a la solicitud más prioritaria
+func (mk *Maekawa) cesion(s solicitudRA) []mensajeMK {
+	if mk.voto != s {
+		return nil
+	}
+	mk.encolar(s)
+	return mk.votarSiguiente()
+}
+
+// liberacion recupera el voto al recibir RELEASE y descarta la solicitud si
+// estaba en cola. Si la solicitud todavía no llega, su marca queda como la
+// última recibida para que se descarte al llegar.
+func (mk *Maekawa) liberacion(s solicitudRA) []mensajeMK {
+	mk.ultimas[s.From] = max(mk.ultimas[s.From], s.Timestamp)
+	mk.cola = slices.DeleteFunc(mk.cola, func(c solicitudRA) bool { return c == s })
+	if mk.voto != s {
+		return nil
+	}
+	return mk.votarSiguiente()
+}
+
+// votarSiguiente da el voto a la solicitud más prioritaria de la cola
+func (mk *Maekawa) votarSiguiente() []mensajeMK {
+	mk.voto = solicitudRA{}
+	mk.consultado = false
+	if len(mk.cola) == 0 {
+		return nil
+	}
+	mk.voto = mk.cola[0]
+	mk.cola = mk.cola[1:]
+	return []mensajeMK{mk.armar("MK_LOCKED", mk.voto.From, mk.voto.Timestamp)}
+}
+
+// votado registra el voto de un votante y entra a la sección crítica con todos
+func (mk *Maekawa) votado(s solicitudRA) []mensajeMK {
+	if mk.estado == liberado || s.Timestamp != mk.marca {
+		// Voto para una solicitud cancelada o terminada: el votante lo
+		// recupera aunque el RELEASE original se le haya adelantado
+		return []mensajeMK{mk.armar("MK_RELEASE", s.From, s.Timestamp)}
+	}
+	if mk.estado != buscando {
+		return nil
+	}
+	mk.votos[s.From] = true
+	if mk.fallido && mk.consultas[s.From] {
+		// El INQUIRE llegó antes que el voto
+		return mk.ceder()
+	}
+	for _, votante := range mk.Quorum() {
+		if !mk.votos[votante] {
+			return nil
+		}
+	}
+	mk.estado = tomado
+	close(mk.listo)
+	return nil
+}
+
+// fallo registra que la solicitud debe esperar y devuelve los votos consultados
+func (mk *Maekawa) fallo(s solicitudRA) []mensajeMK {
+	if mk.estado != buscando || s.Timestamp != mk.marca {
+		return nil
+	}
+	mk.fallido = true
+	return mk.ceder()
+}
+
+// consulta responde un INQUIRE: si la solicitud ya recibió FAILED devuelve el
+// voto; si no, la respuesta queda pendiente
+func (mk *Maekawa) consulta(s solicitudRA) []mensajeMK {
+	if mk.estado != buscando || s.Timestamp != mk.marca {
+		// La solicitud ya entró o terminó: el votante recibirá RELEASE
+		return nil
+	}
+	mk.consultas[s.From] = true
+	if mk.fallido {
+		return mk.ceder()
+	}
+	return nil
+}
+
+// ceder devuelve con RELINQUISH los votos por los que se recibió INQUIRE
+func (mk *Maekawa) ceder() []mensajeMK {
+	var salida []mensajeMK
+	for votante := range mk.consultas {
+		if !mk.votos[votante] {
+			continue
+		}
+		delete(mk.votos, votante)
+		delete(mk.consultas, votante)
+		salida = append(salida, mk.armar("MK_RELINQUISH", votante, mk.marca))
+	}
+	return salida
+}
+
+// encolar inserta una solicitud en la cola según su prioridad
+func (mk *Maekawa) encolar(s solicitudRA) {
+	i := slices.IndexFunc(mk.cola, func(c solicitudRA) bool { return precedeSolicitud(s, c) })
+	if i < 0 {
+		i = len(mk.cola)
+	}
+	mk.cola = slices.Insert(mk.cola, i, s)
+}
+
+// aTodos crea un mensaje con la marca de la solicitud para cada votante del conjunto
+func (mk *Maekawa) aTodos(tipo string) []mensajeMK {
+	var salida []mensajeMK
+	for _, votante := range mk.Quorum() {
+		salida = append(salida, mk.armar(tipo, votante, mk.marca))
+	}
+	return salida
+}
+
+// armar crea un mensaje "TIPO:marca:dirección" para un nodo
+func (mk *Maekawa) armar(tipo, to string, marca int) mensajeMK {
+	return mensajeMK{To: to, Message: fmt.Sprintf("%s:%d:%s", tipo, marca, mk.node.Address)}
+}
+
+// enviar manda los mensajes en orden. Los dirigidos al propio nodo se procesan
+// directamente y no cuentan en las estadísticas. Debe llamarse sin mu tomado.
+func (mk *Maekawa) enviar(salida []mensajeMK) {
+	for _, m := range salida {
+		if m.To == mk.node.Address {
+			mk.handle(m.Message)
+			continue
+		}
+		if err := mk.node.SendMessage(m.To, m.Message); err != nil {
+			mk.node.Logger.Warn("no se pudo enviar mensaje de exclusión mutua", "algorithm", "maekawa",
+				"peer", m.To, "error", err)
+			continue
+		}
+		mk.mensaje()
+	}
+}
+
+// precedeSolicitud indica si la solicitud a tiene prioridad sobre b
+func precedeSolicitud(a, b solicitudRA) bool {
+	return precede(a.Timestamp, a.From, b.Timestamp, b.From)
+}
+
+func init() {
+	RegisterMutex("maekawa", func(n *node.Node) Mutex { return NewMaekawa(n) })
+}
@@ -0,0 +1,46 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestMaekawaQuorumIntersection(t *testing.T) {
+	// Cualquier par de conjuntos de votación comparte un nodo, también con la
+	// última fila de la grilla incompleta
+	for n := 1; n <= 20; n++ {
+		addresses := make([]string, n)
+		for i := range addresses {
+			addresses[i] = fmt.Sprintf("localhost:%d", 8000+i)
+		}
+		quorums := make([][]string, n)
+		for i, address := range addresses {
+			quorums[i] = MaekawaQuorum(addresses, address)
+			if !slices.Contains(quorums[i], address) {
+				t.Errorf("N=%d: %s no está en su conjunto %v", n, address, quorums[i])
+			}
+		}
+		for i := range quorums {
+			for j := i + 1; j < n; j++ {
+				if !slices.ContainsFunc(quorums[i], func(a string) bool { return slices.Contains(quorums[j], a) }) {
+					t.Errorf("N=%d: %v y %v no se intersectan", n, quorums[i], quorums[j])
+				}
+			}
+		}
+	}
+}
+
+func TestMaekawaQuorumSize(t *testing.T) {
+	addresses := make([]string, 9)
+	for i := range addresses {
+		addresses[i] = fmt.Sprint(i)
+	}
+	// Grilla de 3x3: fila y columna del nodo 4
+	if quorum := MaekawaQuorum(addresses, "4"); !slices.Equal(quorum, []string{"1", "3", "4", "5", "7"}) {
+		t.Errorf("conjunto = %v", quorum)
+	}
+	if quorum := MaekawaQuorum(addresses, "x"); quorum != nil {
+		t.Errorf("conjunto de un nodo desconocido = %v", quorum)
+	}
+}
@@ -0,0 +1,194 @@
+package sync
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/metrics"
+	"solemne3_SO/node"
+)
+
+// ErrNoMajority indica que no hay una mayoría de fuentes con intervalos que coincidan
+var ErrNoMajority = errors.New("no hay mayoría de fuentes de hora que coincidan")
+
+// OffsetInterval es el desfase de una fuente de hora respecto al reloj local,
+// con la cota de su error: la hora de la fuente está en [Offset-Bound, Offset+Bound]
+type OffsetInterval struct {
+	Source string        `json:"source"`
+	Offset time.Duration `json:"offset"`
+	Bound  time.Duration `json:"bound"`
+}
+
+// Low retorna el extremo inferior del intervalo
+func (i OffsetInterval) Low() time.Duration { return i.Offset - i.Bound }
+
+// High retorna el extremo superior del intervalo
+func (i OffsetInterval) High() time.Duration { return i.Offset + i.Bound }
+
+// MarzulloResult es la intersección elegida por el algoritmo de Marzullo
+type MarzulloResult struct {
+	Low          time.Duration `json:"low"`          // Extremo inferior de la intersección
+	High         time.Duration `json:"high"`         // Extremo superior de la intersección
+	Sources      int           `json:"sources"`      // Fuentes consideradas
+	Truechimers  []string      `json:"truechimers"`  // Fuentes cuyo intervalo contiene la intersección
+	Falsetickers []string      `json:"falsetickers"` // Fuentes que no coinciden con la intersección
+}
+
+// Offset retorna el centro de la intersección
+func (r MarzulloResult) Offset() time.Duration { return r.Low + (r.High-r.Low)/2 }
+
+// Bound retorna la cota de error del desfase elegido
+func (r MarzulloResult) Bound() time.Duration { return (r.High - r.Low) / 2 }
+
+// Majority indica si más de la mitad de las fuentes coinciden con la intersección
+func (r MarzulloResult) Majority() bool { return 2*len(r.Truechimers) > r.Sources }
+
+// Marzullo elige el intervalo en el que coincide la mayor cantidad de fuentes
+// (algoritmo de Marzullo) y separa las fuentes que lo contienen de las que
+// no. Con varios intervalos igual de respaldados elige el de menor desfase.
+func Marzullo(intervals []OffsetInterval) MarzulloResult {
+	result := MarzulloResult{Sources: len(intervals)}
+	if len(intervals) == 0 {
+		return result
+	}
+
+	// Cada intervalo aporta un borde de inicio (+1) y uno de fin (-1). Con
+	// bordes en el mismo punto los inicios van primero porque los intervalos
+	// son cerrados.
+	type borde struct {
+		at   time.Duration
+		tipo int
+	}
+	bordes := make([]borde, 0, 2*len(intervals))
+	for _, i := range intervals {
+		bordes = append(bordes, borde{i.Low(), +1}, borde{i.High(), -1})
+	}
+	slices.SortFunc(bordes, func(a, b borde) int {
+		return cmp.Or(cmp.Compare(a.at, b.at), cmp.Compare(b.tipo, a.tipo))
+	})
+
+	mejor, cuenta := 0, 0
+	for i, b := range bordes {
+		cuenta += b.tipo
+		if b.tipo < 0 || cuenta < mejor {
+			continue
+		}
+		// Después de un inicio siempre queda al menos un fin
+		candidato := MarzulloResult{Low: b.at, High: bordes[i+1].at}
+		if cuenta > mejor || candidato.Offset().Abs() < result.Offset().Abs() {
+			mejor = cuenta
+			result.Low, result.High = candidato.Low, candidato.High
+		}
+	}
+
+	for _, i := range intervals {
+		if i.Low() <= result.High && i.High() >= result.Low {
+			result.Truechimers = append(result.Truechimers, i.Source)
+		} else {
+			result.Falsetickers = append(result.Falsetickers, i.Source)
+		}
+	}
+	return result
+}
+
+// CristianOffset consulta la hora de un servidor como en Cristian y retorna
+// su desfase respecto al reloj local, sin ajustar el reloj
+func CristianOffset(client *node.Node, serverAddress string) (OffsetInterval, error) {
+	serverTime, serverBound, roundTrip, err := consultarHora(client, serverAddress)
+	if err != nil {
+		return OffsetInterval{}, err
+	}
+	estimatedTime, bound := CristianEstimate(serverTime, roundTrip)
+	metrics.SyncRTT.Observe(roundTrip.Seconds(), client.Name, "marzullo")
+	return OffsetInterval{
+		Source: serverAddress,
+		Offset: estimatedTime.Sub(client.GetClock()),
+		Bound:  bound + serverBound,
+	}, nil
+}
+
+func init() {
+	Register("marzullo", func() Synchronizer { return &marzulloSynchronizer{} })
+}
+
+// marzulloSynchronizer consulta a todos los pares como servidores de hora y
+// ajusta el reloj con la intersección de Marzullo en vez de con la última respuesta
+type marzulloSynchronizer struct {
+	node *node.Node
+}
+
+func (s *marzulloSynchronizer) Name() string { return "marzullo" }
+
+func (s *marzulloSynchronizer) Start(ctx context.Context, n *node.Node) error {
+	s.node = n
+	return nil
+}
+
+// SyncOnce consulta a los pares en paralelo y aplica el desfase en el que
+// coincide la mayoría. La mayoría se cuenta sobre todos los pares
+// configurados, no solo los que respondieron: un par que no responde cuenta
+// como una fuente que no coincide. Sin mayoría el reloj no se ajusta.
+func (s *marzulloSynchronizer) SyncOnce(ctx context.Context) error {
+	var (
+		mu        gosync.Mutex
+		wg        gosync.WaitGroup
+		intervals []OffsetInterval
+		errs      []error
+	)
+	peers := peersOf(s.node)
+	for _, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			interval, err := CristianOffset(s.node, peer)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			intervals = append(intervals, interval)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	log := s.node.Logger.With("algorithm", "marzullo")
+	if len(intervals) == 0 {
+		metrics.SyncFailed(s.node.Name, "marzullo")
+		return errors.Join(errs...)
+	}
+	for _, i := range intervals {
+		metrics.ClockOffset.Set(i.Offset.Seconds(), s.node.Name, i.Source)
+	}
+
+	result := Marzullo(intervals)
+	result.Sources = len(peers)
+	if len(result.Falsetickers) > 0 {
+		log.Warn("fuentes de hora descartadas", "falsetickers", result.Falsetickers)
+	}
+	if !result.Majority() {
+		metrics.SyncFailed(s.node.Name, "marzullo")
+		return errors.Join(append(errs, fmt.Errorf("%w: %d de %d", ErrNoMajority,
+			len(result.Truechimers), result.Sources))...)
+	}
+
+	offset := result.Offset()
+	s.node.SyncClock(s.node.GetClock().Add(offset), result.Bound())
+	s.node.RecordOffset(strings.Join(result.Truechimers, ","), "marzullo", offset)
+	metrics.ObserveAdjustment(s.node.Name, "marzullo", offset)
+	metrics.SyncSucceeded(s.node.Name, "marzullo")
+	log.Info("sincronización completada", "offset", offset, "error_bound", result.Bound(),
+		"truechimers", result.Truechimers)
+	return errors.Join(errs...)
+}
+
+func (s *marzulloSynchronizer) Stop() error { return nil }
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// intervalo arma un intervalo de desfase en milisegundos
+func intervalo(source string, offset, bound int) OffsetInterval {
+	return OffsetInterval{Source: source, Offset: time.Duration(offset) * time.Millisecond, Bound: time.Duration(bound) * time.Millisecond}
+}
+
+func TestMarzulloIntersection(t *testing.T) {
+	// [-10, 10], [0, 20] y [95, 105]: dos fuentes coinciden en [0, 10]
+	result := Marzullo([]OffsetInterval{
+		intervalo("a", 0, 10),
+		intervalo("b", 10, 10),
+		intervalo("c", 100, 5),
+	})
+	if result.Low != 0 || result.High != 10*time.Millisecond {
+		t.Fatalf("intersección = [%s, %s], se esperaba [0s, 10ms]", result.Low, result.High)
+	}
+	if result.Offset() != 5*time.Millisecond || result.Bound() != 5*time.Millisecond {
+		t.Errorf("desfase = %s ±%s, se esperaba 5ms ±5ms", result.Offset(), result.Bound())
+	}
+	if !slices.Equal(result.Truechimers, []string{"a", "b"}) || !slices.Equal(result.Falsetickers, []string{"c"}) {
+		t.Errorf("truechimers = %v, falsetickers = %v", result.Truechimers, result.Falsetickers)
+	}
+	if !result.Majority() {
+		t.Error("dos de tres fuentes no se consideraron mayoría")
+	}
+
+	// Si los demás pares no respondieron, dos fuentes no son mayoría de cinco
+	result.Sources = 5
+	if result.Majority() {
+		t.Error("dos de cinco fuentes se consideraron mayoría")
+	}
+}
+
+func TestMarzulloClosedIntervals(t *testing.T) {
+	// Los intervalos son cerrados: [0, 10] y [10, 20] coinciden en 10
+	result := Marzullo([]OffsetInterval{intervalo("a", 5, 5), intervalo("b", 15, 5)})
+	if result.Low != 10*time.Millisecond || result.High != 10*time.Millisecond {
+		t.Errorf("intersección = [%s, %s], se esperaba [10ms, 10ms]", result.Low, result.High)
+	}
+	if len(result.Truechimers) != 2 {
+		t.Errorf("truechimers = %v", result.Truechimers)
+	}
+}
+
+func TestMarzulloTieBreak(t *testing.T) {
+	// Sin intersección, cada fuente tiene el mismo respaldo y gana la de menor
+	// desfase, sin importar el orden
+	a, b := intervalo("a", -8, 2), intervalo("b", 5, 1)
+	for _, intervals := range [][]OffsetInterval{{a, b}, {b, a}} {
+		result := Marzullo(intervals)
+		if result.Offset() != 5*time.Millisecond {
+			t.Errorf("desfase = %s, se esperaba 5ms", result.Offset())
+		}
+		if !slices.Equal(result.Truechimers, []string{"b"}) {
+			t.Errorf("truechimers = %v, se esperaba [b]", result.Truechimers)
+		}
+	}
+}
+
+func TestMarzulloEmpty(t *testing.T) {
+	result := Marzullo(nil)
+	if result.Majority() || len(result.Truechimers) != 0 {
+		t.Errorf("resultado sin fuentes = %+v", result)
+	}
+}
@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/metrics"
+	"solemne3_SO/node"
+)
+
+// Mutex es una estrategia de exclusión mutua distribuida con estadísticas
+type Mutex interface {
+	node.Locker
+	// Name retorna el nombre con el que la estrategia está registrada
+	Name() string
+	// Stats retorna los mensajes enviados y los tiempos de espera acumulados
+	Stats() MutexStats
+	// Close elimina los manejadores de mensajes de la estrategia
+	Close()
+}
+
+// MutexFactory crea la estrategia de exclusión mutua de un nodo
+type MutexFactory func(n *node.Node) Mutex
+
+var (
+	mutexesMu gosync.RWMutex
+	mutexes   = make(map[string]MutexFactory)
+)
+
+// RegisterMutex agrega una estrategia de exclusión mutua al registro
+func RegisterMutex(name string, factory MutexFactory) {
+	mutexesMu.Lock()
+	defer mutexesMu.Unlock()
+	if _, ok := mutexes[name]; ok {
+		panic("sync: exclusión mutua registrada dos veces: " + name)
+	}
+	mutexes[name] = factory
+}
+
+// NewMutex crea la estrategia de exclusión mutua registrada con ese nombre
+// y registra sus manejadores en el nodo
+func NewMutex(name string, n *node.Node) (Mutex, error) {
+	mutexesMu.RLock()
+	factory, ok := mutexes[name]
+	mutexesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("exclusión mutua no reconocida: %s", name)
+	}
+	return factory(n), nil
+}
+
+// MutexNames retorna los nombres de las estrategias registradas en orden alfabético
+func MutexNames() []string {
+	mutexesMu.RLock()
+	defer mutexesMu.RUnlock()
+	names := make([]string, 0, len(mutexes))
+	for name := range mutexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MutexStats resume el costo de la exclusión mutua en un nodo
+type MutexStats struct {
+	Entries   int           `json:"entries"`    // Entradas a la sección crítica
+	Messages  int           `json:"messages"`   // Mensajes enviados por el nodo
+	TotalWait time.Duration `json:"total_wait"` // Espera acumulada de todas las entradas
+	MaxWait   time.Duration `json:"max_wait"`   // Espera más larga
+}
+
+// AverageWait retorna la espera promedio por entrada
+func (s MutexStats) AverageWait() time.Duration {
+	if s.Entries == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Entries)
+}
+
+// MessagesPerEntry retorna los mensajes enviados por cada entrada
+func (s MutexStats) MessagesPerEntry() float64 {
+	if s.Entries == 0 {
+		return 0
+	}
+	return float64(s.Messages) / float64(s.Entries)
+}
+
+// mutexStats acumula las estadísticas de una estrategia y las publica en las métricas
+type mutexStats struct {
+	node      *node.Node
+	algorithm string
+
+	mu    gosync.Mutex
+	stats MutexStats
+}
+
+// mensaje registra un mensaje enviado
+func (m *mutexStats) mensaje() {
+	m.mu.Lock()
+	m.stats.Messages++
+	m.mu.Unlock()
+	metrics.MutexMessages.Inc(m.node.Name, m.algorithm)
+}
+
+// entrada registra una entrada a la sección crítica y su espera
+func (m *mutexStats) entrada(wait time.Duration) {
+	m.mu.Lock()
+	m.stats.Entries++
+	m.stats.TotalWait += wait
+	m.stats.MaxWait = max(m.stats.MaxWait, wait)
+	m.mu.Unlock()
+	metrics.MutexWait.Observe(wait.Seconds(), m.node.Name, m.algorithm)
+}
+
+// Stats retorna una copia de las estadísticas acumuladas
+func (m *mutexStats) Stats() MutexStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// miembros retorna todos los nodos, incluido el propio, en el orden de la configuración
+func miembros(n *node.Node) []string {
+	todos := slices.Clone(n.Peers)
+	if !slices.Contains(todos, n.Address) {
+		todos = append(todos, n.Address)
+	}
+	return todos
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	gosync "sync"
+
+	"solemne3_SO/node"
+)
+
+// Observer recibe los resultados de cada sincronización completada o fallida
+type Observer interface {
+	CristianCompleted(n *node.Node, result CristianResult, err error)
+	BerkeleyCompleted(n *node.Node, round BerkeleyRound, err error)
+}
+
+var (
+	observersMu gosync.RWMutex
+	observers   []Observer
+)
+
+// AddObserver registra un observador que será notificado en cada sincronización
+func AddObserver(o Observer) {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	observers = append(observers, o)
+}
+
+// notifyCristian entrega un resultado de Cristian a los observadores
+func notifyCristian(n *node.Node, result CristianResult, err error) {
+	observersMu.RLock()
+	defer observersMu.RUnlock()
+	for _, o := range observers {
+		o.CristianCompleted(n, result, err)
+	}
+}
+
+// notifyBerkeley entrega una ronda de Berkeley a los observadores
+func notifyBerkeley(n *node.Node, round BerkeleyRound, err error) {
+	observersMu.RLock()
+	defer observersMu.RUnlock()
+	for _, o := range observers {
+		o.BerkeleyCompleted(n, round, err)
+	}
+}
+
+// LogObserver escribe un resumen de cada sincronización en el logger del nodo
+type LogObserver struct{}
+
+// CristianCompleted implementa Observer
+func (LogObserver) CristianCompleted(n *node.Node, result CristianResult, err error) {
+	log := n.Logger.With("algorithm", "cristian", "peer", result.Peer, "round", result.Round)
+	if err != nil {
+		log.Error("sincronización fallida", "error", err)
+		return
+	}
+	log.Info("sincronización completada",
+		"offset", result.Offset,
+		"rtt", result.RTT,
+		"error_bound", result.ErrorBound,
+		"server_time", result.ServerTime)
+}
+
+// BerkeleyCompleted implementa Observer
+func (LogObserver) BerkeleyCompleted(n *node.Node, round BerkeleyRound, err error) {
+	log := n.Logger.With("algorithm", "berkeley", "round", round.ID)
+	for peer, reason := range round.Excluded {
+		log.Warn("nodo excluido de la ronda", "peer", peer, "error", reason)
+	}
+	if err != nil {
+		log.Error("sincronización fallida", "error", err)
+		return
+	}
+	for peer, adjustment := range round.Adjustments {
+		log.Info("ajuste calculado", "peer", peer, "offset", adjustment, "diff", round.Diffs[peer])
+	}
+	log.Info("sincronización completada", "average", round.Average, "responses", len(round.Diffs))
+}
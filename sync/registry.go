@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	gosync "sync"
+
+	"solemne3_SO/node"
+)
+
+// Synchronizer es la interfaz común de los algoritmos de sincronización
+type Synchronizer interface {
+	// Name retorna el nombre con el que el algoritmo está registrado
+	Name() string
+	// Start asocia el algoritmo a un nodo y registra sus manejadores de mensajes
+	Start(ctx context.Context, n *node.Node) error
+	// SyncOnce ejecuta una ronda de sincronización
+	SyncOnce(ctx context.Context) error
+	// Stop libera los recursos y manejadores del algoritmo
+	Stop() error
+}
+
+// Coordinator lo implementan los algoritmos cuyas rondas debe ejecutar un solo
+// nodo. Si varios coordinadores ejecutan rondas a la vez, cada nodo aplica
+// varios ajustes superpuestos por ronda y los relojes divergen.
+type Coordinator interface {
+	Synchronizer
+	// Coordinator no hace nada; solo marca al algoritmo
+	Coordinator()
+}
+
+// Factory crea una instancia nueva de un algoritmo
+type Factory func() Synchronizer
+
+var (
+	registryMu gosync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register agrega un algoritmo al registro. Registrar dos veces el mismo nombre es un error de programación.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("sync: algoritmo registrado dos veces: " + name)
+	}
+	registry[name] = factory
+}
+
+// New crea una instancia del algoritmo registrado con ese nombre
+func New(name string) (Synchronizer, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("algoritmo no reconocido: %s", name)
+	}
+	return factory(), nil
+}
+
+// NeedsCoordinator indica si el algoritmo registrado con ese nombre debe
+// ejecutar sus rondas desde un solo nodo
+func NeedsCoordinator(name string) bool {
+	s, err := New(name)
+	if err != nil {
+		return false
+	}
+	_, ok := s.(Coordinator)
+	return ok
+}
+
+// Names retorna los nombres de los algoritmos registrados en orden alfabético
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// peersOf retorna los pares de un nodo excluyéndose a sí mismo
+func peersOf(n *node.Node) []string {
+	peers := make([]string, 0, len(n.Peers))
+	for _, peer := range n.Peers {
+		if peer != n.Address {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
@@ -0,0 +1,249 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/metrics"
+	"solemne3_SO/node"
+)
+
+// Estados de un nodo respecto de la sección crítica
+const (
+	liberado = iota // Fuera de la sección crítica y sin solicitarla
+	buscando        // Esperando permiso para entrar
+	tomado          // Dentro de la sección crítica
+)
+
+// solicitudRA es una solicitud de otro nodo cuya respuesta se difirió
+type solicitudRA struct {
+	From      string
+	Timestamp int
+}
+
+// RicartAgrawala implementa la exclusión mutua de Ricart–Agrawala: el nodo
+// envía REQUEST(ts, id) a todos los pares y entra a la sección crítica cuando
+// todos respondieron REPLY. Un nodo difiere su respuesta mientras está en la
+// sección crítica o si su propia solicitud tiene prioridad (menor marca de
+// Lamport, desempatando por dirección). Cada entrada cuesta 2(N-1) mensajes.
+type RicartAgrawala struct {
+	node  *node.Node
+	reloj *RelojLógico
+	mutexStats
+
+	mu         gosync.Mutex
+	estado     int
+	marca      int             // Marca de Lamport de la solicitud en curso
+	respuestas map[string]bool // Pares que respondieron la solicitud en curso
+	diferidos  []solicitudRA   // Solicitudes que se responden al salir
+	ultimas    map[string]int  // Marca de la última solicitud recibida de cada par
+	listo      chan struct{}   // Se cierra al obtener todas las respuestas
+}
+
+// NewRicartAgrawala crea la exclusión mutua de un nodo y registra los
+// manejadores de los mensajes RA_REQUEST y RA_REPLY
+func NewRicartAgrawala(n *node.Node) *RicartAgrawala {
+	ra := &RicartAgrawala{
+		node:       n,
+		reloj:      RelojDeNodo(n),
+		mutexStats: mutexStats{node: n, algorithm: "ricart"},
+		ultimas:    make(map[string]int),
+	}
+	n.RegisterHandler("RA_REQUEST:", func(message string, conn net.Conn) {
+		ra.handleRequest(message)
+	})
+	n.RegisterHandler("RA_REPLY:", func(message string, conn net.Conn) {
+		ra.handleReply(message)
+	})
+	return ra
+}
+
+func (ra *RicartAgrawala) Name() string { return "ricart" }
+
+// Lock solicita la sección crítica a todos los pares y espera sus respuestas.
+// Si ctx se cancela antes, la solicitud se abandona y se responden las
+// solicitudes diferidas.
+func (ra *RicartAgrawala) Lock(ctx context.Context) error {
+	start := time.Now()
+
+	ra.mu.Lock()
+	if ra.estado != liberado {
+		ra.mu.Unlock()
+		return errors.New("la sección crítica ya fue solicitada por este nodo")
+	}
+	ra.reloj.Incrementa()
+	ra.estado = buscando
+	ra.marca = ra.reloj.Get()
+	ra.respuestas = make(map[string]bool)
+	ra.listo = make(chan struct{})
+	marca, listo := ra.marca, ra.listo
+	peers := peersOf(ra.node)
+	if len(peers) == 0 {
+		ra.estado = tomado
+		close(listo)
+	}
+	ra.mu.Unlock()
+
+	metrics.LamportClock.Set(float64(marca), ra.node.Name)
+	for _, peer := range peers {
+		ra.enviar(peer, fmt.Sprintf("RA_REQUEST:%d:%s", marca, ra.node.Address))
+	}
+
+	select {
+	case <-listo:
+		wait := time.Since(start)
+		ra.entrada(wait)
+		ra.node.Logger.Debug("sección crítica obtenida", "algorithm", "ricart", "lamport", marca, "wait", wait)
+		return nil
+	case <-ctx.Done():
+		ra.mu.Lock()
+		select {
+		case <-listo:
+			// Las respuestas llegaron junto con la cancelación
+			ra.estado = tomado
+		default:
+		}
+		ra.mu.Unlock()
+		ra.salir()
+		return ctx.Err()
+	}
+}
+
+// Unlock sale de la sección crítica y responde las solicitudes diferidas
+func (ra *RicartAgrawala) Unlock() error {
+	ra.mu.Lock()
+	estado := ra.estado
+	ra.mu.Unlock()
+	if estado != tomado {
+		return errors.New("el nodo no está en la sección crítica")
+	}
+	ra.salir()
+	return nil
+}
+
+// Close elimina los manejadores de mensajes RA_REQUEST y RA_REPLY
+func (ra *RicartAgrawala) Close() {
+	ra.node.UnregisterHandler("RA_REQUEST:")
+	ra.node.UnregisterHandler("RA_REPLY:")
+}
+
+// salir vuelve al estado liberado y envía las respuestas diferidas
+func (ra *RicartAgrawala) salir() {
+	ra.mu.Lock()
+	ra.estado = liberado
+	diferidos := ra.diferidos
+	ra.diferidos = nil
+	ra.mu.Unlock()
+
+	for _, s := range diferidos {
+		ra.responder(s)
+	}
+}
+
+// handleRequest responde una solicitud o la difiere si este nodo tiene prioridad
+func (ra *RicartAgrawala) handleRequest(message string) {
+	s, ok := parseMensajeRA(message)
+	if !ok {
+		ra.node.Logger.Warn("solicitud de exclusión mutua inválida", "message", message)
+		return
+	}
+	if !slices.Contains(peersOf(ra.node), s.From) {
+		ra.node.Logger.Warn("solicitud de exclusión mutua de un nodo desconocido", "from", s.From)
+		return
+	}
+
+	ra.mu.Lock()
+	if s.Timestamp <= ra.ultimas[s.From] {
+		// Solicitud duplicada: las marcas de un mismo nodo siempre crecen
+		ra.mu.Unlock()
+		return
+	}
+	ra.ultimas[s.From] = s.Timestamp
+	ra.reloj.Sincroniza(s.Timestamp)
+	metrics.LamportClock.Set(float64(ra.reloj.Get()), ra.node.Name)
+
+	diferir := ra.estado == tomado ||
+		(ra.estado == buscando && precede(ra.marca, ra.node.Address, s.Timestamp, s.From))
+	if diferir {
+		ra.diferidos = append(ra.diferidos, s)
+	}
+	ra.mu.Unlock()
+
+	if !diferir {
+		ra.responder(s)
+	}
+}
+
+// handleReply registra la respuesta de un par a la solicitud en curso
+func (ra *RicartAgrawala) handleReply(message string) {
+	s, ok := parseMensajeRA(message)
+	if !ok {
+		ra.node.Logger.Warn("respuesta de exclusión mutua inválida", "message", message)
+		return
+	}
+	if !slices.Contains(peersOf(ra.node), s.From) {
+		// Solo cuentan las respuestas de los pares configurados, o un nodo
+		// ajeno podría completar las respuestas esperadas
+		ra.node.Logger.Warn("respuesta de exclusión mutua de un nodo desconocido", "from", s.From)
+		return
+	}
+
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	if ra.estado != buscando || s.Timestamp != ra.marca || ra.respuestas[s.From] {
+		// Respuesta a una solicitud abandonada o duplicada
+		return
+	}
+	ra.respuestas[s.From] = true
+	if len(ra.respuestas) == len(peersOf(ra.node)) {
+		ra.estado = tomado
+		close(ra.listo)
+	}
+}
+
+// responder envía REPLY a una solicitud, con la marca de esa solicitud
+func (ra *RicartAgrawala) responder(s solicitudRA) {
+	ra.enviar(s.From, fmt.Sprintf("RA_REPLY:%d:%s", s.Timestamp, ra.node.Address))
+}
+
+// enviar manda un mensaje de la exclusión mutua y lo cuenta en las estadísticas
+func (ra *RicartAgrawala) enviar(peer, message string) {
+	if err := ra.node.SendMessage(peer, message); err != nil {
+		ra.node.Logger.Warn("no se pudo enviar mensaje de exclusión mutua", "algorithm", "ricart",
+			"peer", peer, "error", err)
+		return
+	}
+	ra.mensaje()
+}
+
+// parseMensajeRA interpreta "RA_REQUEST:ts:dirección" y "RA_REPLY:ts:dirección"
+func parseMensajeRA(message string) (solicitudRA, bool) {
+	parts := strings.SplitN(message, ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return solicitudRA{}, false
+	}
+	ts, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return solicitudRA{}, false
+	}
+	return solicitudRA{From: parts[2], Timestamp: ts}, true
+}
+
+// precede indica si la solicitud (ts, id) tiene prioridad sobre (otroTs, otroID)
+func precede(ts int, id string, otroTs int, otroID string) bool {
+	if ts != otroTs {
+		return ts < otroTs
+	}
+	return id < otroID
+}
+
+func init() {
+	RegisterMutex("ricart", func(n *node.Node) Mutex { return NewRicartAgrawala(n) })
+}
@@ -0,0 +1,13 @@
+package sync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newRoundID genera un identificador corto para correlacionar los logs de una ronda
+func newRoundID() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,443 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// ErrSnapshotIncomplete indica que no todos los nodos enviaron su estado a tiempo
+var ErrSnapshotIncomplete = errors.New("instantánea incompleta")
+
+// SnapshotGapTimeout es el tiempo que un mensaje espera a los anteriores de su
+// canal antes de darlos por perdidos
+var SnapshotGapTimeout = time.Second
+
+// SnapshotMaxAge es el tiempo que un nodo espera los marcadores de una
+// instantánea antes de abandonarla, por ejemplo porque alguno se perdió
+var SnapshotMaxAge = 2 * time.Minute
+
+// maxTerminadas es la cantidad de instantáneas completadas que recuerda cada
+// nodo para ignorar sus marcadores atrasados
+const maxTerminadas = 1000
+
+// SnapshotStateFunc retorna el estado de la aplicación que se incluye en la instantánea
+type SnapshotStateFunc func() any
+
+// NodeSnapshot es el estado registrado por un nodo en una instantánea global
+type NodeSnapshot struct {
+	Node     string              `json:"node"`
+	Address  string              `json:"address"`
+	Clock    string              `json:"clock"`           // Reloj físico al registrar el estado
+	Lamport  int                 `json:"lamport"`         // Reloj lógico al registrar el estado
+	State    any                 `json:"state,omitempty"` // Estado de la aplicación
+	Channels map[string][]string `json:"channels"`        // Mensajes en tránsito por canal entrante (remitente -> mensajes)
+}
+
+// GlobalSnapshot es el estado global consistente del clúster
+type GlobalSnapshot struct {
+	ID        string         `json:"id"`
+	Initiator string         `json:"initiator"`
+	Started   string         `json:"started"`
+	Complete  bool           `json:"complete"` // Todos los nodos enviaron su estado
+	Nodes     []NodeSnapshot `json:"nodes"`
+}
+
+// marcador es el mensaje SNAPSHOT_MARKER que propaga una instantánea
+type marcador struct {
+	ID        string `json:"id"`
+	Initiator string `json:"initiator"`
+	From      string `json:"from"`
+}
+
+// canalEntrante ordena los mensajes de un canal según su número de secuencia
+type canalEntrante struct {
+	siguiente uint64                   // Secuencia del próximo mensaje a procesar
+	esperando map[uint64]chan struct{} // Mensajes que esperan su turno
+}
+
+// instantanea es una instantánea en curso en un nodo
+type instantanea struct {
+	marcador
+	local    NodeSnapshot
+	abiertos map[string]bool // Canales entrantes que aún no recibieron el marcador
+	inicio   time.Time       // Momento en que se registró el estado local
+}
+
+// recoleccion son los estados que recibe el iniciador de una instantánea
+type recoleccion struct {
+	estados   chan NodeSnapshot
+	recibidos map[string]bool // Nodos cuyo estado ya se recibió, por dirección
+}
+
+// Snapshotter toma instantáneas globales con el algoritmo de Chandy–Lamport:
+// el nodo que inicia registra su estado y envía un marcador por cada canal
+// saliente. Al recibir el primer marcador un nodo registra su estado, reenvía
+// el marcador y graba los mensajes que llegan por los demás canales hasta
+// recibir el marcador en cada uno. Cada nodo envía su estado al iniciador,
+// que arma el documento global.
+//
+// El algoritmo necesita canales FIFO, pero cada mensaje viaja por su propia
+// conexión. Por eso los mensajes llevan un número de secuencia por canal (ver
+// node.ObserveMessages) y se procesan en ese orden; un mensaje que llega antes
+// que los anteriores espera hasta SnapshotGapTimeout y luego se dan por
+// perdidos. Además el estado se registra con exclusión de los mensajes en
+// proceso, de modo que cada mensaje queda en el estado o en la grabación del
+// canal, pero no en ambos ni en ninguno.
+//
+// El iniciador acepta un solo estado por nodo, y solo de los nodos
+// configurados. Si un marcador se pierde, la instantánea se abandona tras
+// SnapshotMaxAge.
+type Snapshotter struct {
+	node  *node.Node
+	reloj *RelojLógico
+	state SnapshotStateFunc
+
+	// procesando se toma para lectura mientras se graba y procesa un mensaje
+	// y para escritura al registrar el estado local
+	procesando gosync.RWMutex
+
+	mu         gosync.Mutex
+	seq        int                       // Instantáneas iniciadas por este nodo
+	activas    map[string]*instantanea   // Instantáneas en curso, por id
+	terminadas map[string]bool           // Instantáneas que este nodo ya completó o abandonó
+	orden      []string                  // Instantáneas completadas, de la más antigua a la más reciente
+	canales    map[string]*canalEntrante // Orden de los mensajes de cada canal entrante
+	recolecta  map[string]*recoleccion   // Estados recibidos como iniciador, por id
+	dejar      func()                    // Deja de observar los mensajes entrantes
+}
+
+// NewSnapshotter registra los manejadores SNAPSHOT_MARKER y SNAPSHOT_STATE y
+// observa los mensajes entrantes del nodo. state puede ser nil.
+func NewSnapshotter(n *node.Node, state SnapshotStateFunc) *Snapshotter {
+	s := &Snapshotter{
+		node:       n,
+		reloj:      RelojDeNodo(n),
+		state:      state,
+		activas:    make(map[string]*instantanea),
+		terminadas: make(map[string]bool),
+		canales:    make(map[string]*canalEntrante),
+		recolecta:  make(map[string]*recoleccion),
+	}
+	n.RegisterHandler("SNAPSHOT_MARKER:", func(message string, conn net.Conn) {
+		s.handleMarker(message)
+	})
+	n.RegisterHandler("SNAPSHOT_STATE:", func(message string, conn net.Conn) {
+		s.handleState(message)
+	})
+	s.dejar = n.ObserveMessages(s.observar)
+	return s
+}
+
+// Take inicia una instantánea desde este nodo y espera el estado de todos los
+// nodos. Si ctx se cancela antes retorna lo recolectado junto con el error.
+func (s *Snapshotter) Take(ctx context.Context) (GlobalSnapshot, error) {
+	s.mu.Lock()
+	s.seq++
+	// El sufijo aleatorio evita que el id se repita si el nodo se reinicia
+	m := marcador{
+		ID:        fmt.Sprintf("%s-%d-%s", s.node.Address, s.seq, newRoundID()),
+		Initiator: s.node.Address,
+		From:      s.node.Address,
+	}
+	miembros := miembros(s.node)
+	estados := make(chan NodeSnapshot, len(miembros))
+	s.recolecta[m.ID] = &recoleccion{estados: estados, recibidos: make(map[string]bool)}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.recolecta, m.ID)
+		s.mu.Unlock()
+	}()
+
+	global := GlobalSnapshot{ID: m.ID, Initiator: m.Initiator, Started: node.FormatTime(s.node.GetClock())}
+	s.node.Logger.Info("iniciando instantánea global", "snapshot", m.ID)
+	s.registrar(m)
+
+	// La instantánea está completa cuando llegó el estado de cada miembro
+	recibidos := make(map[string]bool)
+	for len(recibidos) < len(miembros) {
+		select {
+		case estado := <-estados:
+			if recibidos[estado.Address] {
+				continue
+			}
+			recibidos[estado.Address] = true
+			global.Nodes = append(global.Nodes, estado)
+		case <-ctx.Done():
+			return global, fmt.Errorf("%w: %d de %d nodos: %w", ErrSnapshotIncomplete,
+				len(recibidos), len(miembros), ctx.Err())
+		}
+	}
+	global.Complete = true
+	return global, nil
+}
+
+// Close deja de observar los mensajes y elimina los manejadores
+func (s *Snapshotter) Close() {
+	s.dejar()
+	s.node.UnregisterHandler("SNAPSHOT_MARKER:")
+	s.node.UnregisterHandler("SNAPSHOT_STATE:")
+}
+
+// handleMarker registra el estado local con el primer marcador de una
+// instantánea (registrar ignora los siguientes) y cierra el canal por el que llegó
+func (s *Snapshotter) handleMarker(message string) {
+	var m marcador
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, "SNAPSHOT_MARKER:")), &m); err != nil || m.ID == "" {
+		s.node.Logger.Warn("marcador de instantánea inválido", "message", message)
+		return
+	}
+
+	s.registrar(m)
+
+	s.mu.Lock()
+	inst, ok := s.activas[m.ID]
+	if ok {
+		delete(inst.abiertos, m.From)
+	}
+	s.mu.Unlock()
+	if ok {
+		s.terminar(inst)
+	}
+}
+
+// registrar guarda el estado local, empieza a grabar los canales entrantes y
+// envía el marcador a todos los pares
+func (s *Snapshotter) registrar(m marcador) {
+	// Ningún mensaje puede estar entre su grabación y su procesamiento
+	// mientras se registra el estado
+	s.procesando.Lock()
+	s.mu.Lock()
+	if _, existe := s.activas[m.ID]; existe || s.terminadas[m.ID] {
+		s.mu.Unlock()
+		s.procesando.Unlock()
+		return
+	}
+	s.abandonar(time.Now())
+	local := NodeSnapshot{
+		Node:     s.node.Name,
+		Address:  s.node.Address,
+		Clock:    node.FormatTime(s.node.GetClock()),
+		Lamport:  s.reloj.Get(),
+		Channels: make(map[string][]string),
+	}
+	if s.state != nil {
+		local.State = s.state()
+	}
+	inst := &instantanea{marcador: m, local: local, abiertos: make(map[string]bool), inicio: time.Now()}
+	peers := peersOf(s.node)
+	for _, peer := range peers {
+		inst.abiertos[peer] = true
+	}
+	s.activas[m.ID] = inst
+	s.mu.Unlock()
+	s.procesando.Unlock()
+
+	s.node.Logger.Debug("estado local registrado", "snapshot", m.ID, "lamport", local.Lamport)
+
+	salida := marcador{ID: m.ID, Initiator: m.Initiator, From: s.node.Address}
+	data, _ := json.Marshal(salida)
+	for _, peer := range peers {
+		if err := s.node.SendMessage(peer, "SNAPSHOT_MARKER:"+string(data)); err != nil {
+			s.node.Logger.Warn("no se pudo enviar marcador", "snapshot", m.ID, "peer", peer, "error", err)
+		}
+	}
+	s.terminar(inst)
+}
+
+// observar procesa un mensaje entrante en el orden de su canal. Los mensajes
+// de la aplicación se graban en los canales abiertos y se procesan sin soltar
+// procesando, para que registrar no quede entre ambos pasos. Los de la
+// instantánea se procesan sin tomarlo, porque el marcador llama a registrar.
+func (s *Snapshotter) observar(from string, seq uint64, message string, handle func()) {
+	if from != "" && seq > 0 {
+		s.esperarTurno(from, seq)
+	}
+
+	if from == "" || strings.HasPrefix(message, "SNAPSHOT_") {
+		handle()
+		s.terminarTurno(from, seq)
+		return
+	}
+
+	s.procesando.RLock()
+	defer s.procesando.RUnlock()
+	s.grabar(from, message)
+	// El siguiente mensaje del canal puede grabarse mientras este se procesa:
+	// un marcador posterior espera en registrar a que termine
+	s.terminarTurno(from, seq)
+	handle()
+}
+
+// grabar agrega un mensaje entrante a los canales que se están grabando
+func (s *Snapshotter) grabar(from, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.abandonar(time.Now())
+	for _, inst := range s.activas {
+		if inst.abiertos[from] {
+			inst.local.Channels[from] = append(inst.local.Channels[from], message)
+		}
+	}
+}
+
+// esperarTurno espera que se procesen los mensajes anteriores del canal. Los
+// mensajes atrasados (o de un canal que no se conocía) pasan de inmediato, y
+// la secuencia 1 indica que el remitente se reinició.
+func (s *Snapshotter) esperarTurno(from string, seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.canales[from]
+	if !ok || seq == 1 {
+		c = &canalEntrante{siguiente: seq, esperando: make(map[uint64]chan struct{})}
+		s.canales[from] = c
+	}
+	if seq <= c.siguiente {
+		return
+	}
+
+	listo, ok := c.esperando[seq]
+	if !ok {
+		listo = make(chan struct{})
+		c.esperando[seq] = listo
+	}
+	s.mu.Unlock()
+	timer := time.NewTimer(SnapshotGapTimeout)
+	select {
+	case <-listo:
+	case <-timer.C:
+	}
+	timer.Stop()
+	s.mu.Lock()
+
+	if seq > c.siguiente {
+		s.node.Logger.Warn("mensajes faltantes en el canal, se dan por perdidos", "peer", from,
+			"expected", c.siguiente, "seq", seq)
+		c.siguiente = seq
+		s.despertar(c)
+	}
+}
+
+// terminarTurno deja pasar al siguiente mensaje del canal
+func (s *Snapshotter) terminarTurno(from string, seq uint64) {
+	if from == "" || seq == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.canales[from]
+	if c == nil || seq < c.siguiente {
+		return
+	}
+	c.siguiente = seq + 1
+	s.despertar(c)
+}
+
+// despertar libera a los mensajes del canal a los que ya les toca. Debe
+// llamarse con mu tomado.
+func (s *Snapshotter) despertar(c *canalEntrante) {
+	for seq, listo := range c.esperando {
+		if seq <= c.siguiente {
+			close(listo)
+			delete(c.esperando, seq)
+		}
+	}
+}
+
+// terminar envía el estado local al iniciador si ya llegaron todos los marcadores
+func (s *Snapshotter) terminar(inst *instantanea) {
+	s.mu.Lock()
+	if len(inst.abiertos) > 0 || s.activas[inst.ID] != inst {
+		s.mu.Unlock()
+		return
+	}
+	s.olvidar(inst.ID)
+	r, local := s.recolecta[inst.ID]
+	if local {
+		r.recibidos[s.node.Address] = true
+	}
+	s.mu.Unlock()
+
+	if inst.Initiator == s.node.Address {
+		if local {
+			r.estados <- inst.local
+		}
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		ID    string       `json:"id"`
+		State NodeSnapshot `json:"state"`
+	}{inst.ID, inst.local})
+	if err == nil {
+		err = s.node.SendMessage(inst.Initiator, "SNAPSHOT_STATE:"+string(data))
+	}
+	if err != nil {
+		s.node.Logger.Warn("no se pudo enviar el estado de la instantánea", "snapshot", inst.ID, "error", err)
+	}
+}
+
+// olvidar da por terminada una instantánea en curso, para ignorar sus
+// marcadores atrasados. Debe llamarse con mu tomado.
+func (s *Snapshotter) olvidar(id string) {
+	delete(s.activas, id)
+	s.terminadas[id] = true
+	s.orden = append(s.orden, id)
+	if len(s.orden) > maxTerminadas {
+		delete(s.terminadas, s.orden[0])
+		s.orden = s.orden[1:]
+	}
+}
+
+// abandonar descarta las instantáneas que llevan más de SnapshotMaxAge
+// esperando marcadores. Debe llamarse con mu tomado.
+func (s *Snapshotter) abandonar(now time.Time) {
+	for id, inst := range s.activas {
+		if now.Sub(inst.inicio) > SnapshotMaxAge {
+			s.node.Logger.Warn("instantánea abandonada, faltan marcadores", "snapshot", id,
+				"missing", len(inst.abiertos))
+			s.olvidar(id)
+		}
+	}
+}
+
+// handleState recibe como iniciador el estado de otro nodo. Se descartan los
+// estados repetidos y los de nodos que no son pares.
+func (s *Snapshotter) handleState(message string) {
+	var msg struct {
+		ID    string       `json:"id"`
+		State NodeSnapshot `json:"state"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, "SNAPSHOT_STATE:")), &msg); err != nil {
+		s.node.Logger.Warn("estado de instantánea inválido", "error", err)
+		return
+	}
+
+	// El estado propio del iniciador nunca llega como mensaje
+	if msg.State.Address == s.node.Address || !slices.Contains(miembros(s.node), msg.State.Address) {
+		s.node.Logger.Warn("estado de instantánea de un nodo desconocido", "snapshot", msg.ID,
+			"address", msg.State.Address)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.recolecta[msg.ID]
+	if !ok || r.recibidos[msg.State.Address] {
+		// Instantánea abandonada por el iniciador, o estado repetido
+		return
+	}
+	r.recibidos[msg.State.Address] = true
+	// El canal tiene lugar para un estado por miembro, por lo que no se bloquea
+	r.estados <- msg.State
+}
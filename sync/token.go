@@ -0,0 +1,351 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// TokenTimeout es el tiempo sin ver el token tras el cual un nodo sospecha que se perdió
+var TokenTimeout = 2 * time.Second
+
+// TokenIdle es la pausa con que un nodo que no necesita el token lo pasa al siguiente
+var TokenIdle = 20 * time.Millisecond
+
+// tokenID identifica un token por su generación y el nodo que lo generó. Seq
+// cuenta los pasos del token para descartar los mensajes duplicados.
+type tokenID struct {
+	Gen     int
+	Creator string
+	Seq     int
+}
+
+// menorQue indica si el token es más antiguo que otro
+func (t tokenID) menorQue(otro tokenID) bool {
+	if t.Gen != otro.Gen {
+		return t.Gen < otro.Gen
+	}
+	if t.Creator != otro.Creator {
+		return t.Creator < otro.Creator
+	}
+	return t.Seq < otro.Seq
+}
+
+// TokenRing implementa la exclusión mutua con un token que circula por un
+// anillo ordenado según la lista de nodos de la configuración. Solo entra a la
+// sección crítica el nodo que tiene el token; al pasarlo se saltan los
+// sucesores caídos. Si un nodo no ve el token durante Timeout consulta a los
+// pares y, si nadie lo tiene ni lo vio hace poco, genera uno nuevo con la
+// generación siguiente. Los nodos descartan los tokens de generaciones
+// anteriores a la mayor que conocen, de modo que no circulan tokens duplicados.
+type TokenRing struct {
+	node *node.Node
+	mutexStats
+	Timeout time.Duration // Tiempo sin ver el token antes de sospechar que se perdió
+	Idle    time.Duration // Pausa antes de pasar el token si no se necesita
+	cancel  context.CancelFunc
+
+	mu      gosync.Mutex
+	token   tokenID       // Token más reciente conocido
+	tiene   bool          // El nodo tiene el token
+	estado  int           // liberado, buscando o tomado
+	listo   chan struct{} // Se cierra cuando llega el token solicitado
+	visto   time.Time     // Última vez que el nodo tuvo el token o supo de él
+	pasando bool          // Hay un paso del token programado
+	cerrado bool
+}
+
+// NewTokenRing crea la exclusión mutua por token de un nodo, registra los
+// manejadores TOKEN y TOKEN_PROBE e inicia el detector de token perdido.
+// El primer nodo del anillo genera el token inicial.
+func NewTokenRing(n *node.Node) *TokenRing {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &TokenRing{
+		node:       n,
+		mutexStats: mutexStats{node: n, algorithm: "token"},
+		Timeout:    TokenTimeout,
+		Idle:       TokenIdle,
+		cancel:     cancel,
+		visto:      time.Now(),
+	}
+	n.RegisterHandler("TOKEN:", func(message string, conn net.Conn) {
+		r.handleToken(message)
+	})
+	n.RegisterHandler("TOKEN_PROBE", func(message string, conn net.Conn) {
+		r.handleProbe(conn)
+	})
+
+	if anillo := r.anillo(); len(anillo) > 0 && anillo[0] == n.Address {
+		r.mu.Lock()
+		r.token = tokenID{Gen: 1, Creator: n.Address}
+		r.tiene = true
+		r.usar()
+		r.mu.Unlock()
+	}
+
+	go r.detectar(ctx)
+	return r
+}
+
+func (r *TokenRing) Name() string { return "token" }
+
+// Lock espera el token. Si el nodo ya lo tiene entra de inmediato.
+func (r *TokenRing) Lock(ctx context.Context) error {
+	start := time.Now()
+
+	r.mu.Lock()
+	if r.estado != liberado {
+		r.mu.Unlock()
+		return errors.New("la sección crítica ya fue solicitada por este nodo")
+	}
+	if r.tiene {
+		r.estado = tomado
+		r.mu.Unlock()
+		r.entrada(time.Since(start))
+		return nil
+	}
+	r.estado = buscando
+	r.listo = make(chan struct{})
+	listo := r.listo
+	r.mu.Unlock()
+
+	select {
+	case <-listo:
+		wait := time.Since(start)
+		r.entrada(wait)
+		r.node.Logger.Debug("sección crítica obtenida", "algorithm", "token", "wait", wait)
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		r.estado = liberado
+		if r.tiene {
+			// El token llegó junto con la cancelación: se pasa al siguiente
+			r.usar()
+		}
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Unlock sale de la sección crítica y pasa el token al siguiente nodo
+func (r *TokenRing) Unlock() error {
+	r.mu.Lock()
+	if r.estado != tomado {
+		r.mu.Unlock()
+		return errors.New("el nodo no está en la sección crítica")
+	}
+	r.estado = liberado
+	r.mu.Unlock()
+
+	r.pasar()
+	return nil
+}
+
+// Close detiene el detector, elimina los manejadores y entrega el token al
+// siguiente nodo si este lo tiene
+func (r *TokenRing) Close() {
+	r.cancel()
+	r.node.UnregisterHandler("TOKEN:")
+	r.node.UnregisterHandler("TOKEN_PROBE")
+
+	r.mu.Lock()
+	r.cerrado = true
+	r.mu.Unlock()
+	r.pasar()
+}
+
+// anillo retorna los nodos del anillo en el orden de la configuración
+func (r *TokenRing) anillo() []string {
+	return miembros(r.node)
+}
+
+// sucesores retorna los demás nodos en el orden en que se les ofrece el token
+func (r *TokenRing) sucesores() []string {
+	anillo := r.anillo()
+	i := slices.Index(anillo, r.node.Address)
+	return append(anillo[i+1:], anillo[:i]...)
+}
+
+// usar entrega el token a un Lock en espera o programa su paso al siguiente
+// nodo. Debe llamarse con mu tomado y con el token en el nodo.
+func (r *TokenRing) usar() {
+	r.visto = time.Now()
+	if r.estado == buscando {
+		r.estado = tomado
+		close(r.listo)
+		return
+	}
+	if r.estado == liberado && !r.pasando && !r.cerrado {
+		r.pasando = true
+		time.AfterFunc(r.Idle, func() {
+			r.mu.Lock()
+			r.pasando = false
+			r.mu.Unlock()
+			r.pasar()
+		})
+	}
+}
+
+// pasar envía el token al primer sucesor que lo acepte. Si ninguno responde
+// el nodo lo conserva y vuelve a intentarlo más tarde.
+func (r *TokenRing) pasar() {
+	r.mu.Lock()
+	if !r.tiene || r.estado != liberado {
+		r.mu.Unlock()
+		return
+	}
+	r.tiene = false
+	r.visto = time.Now()
+	r.token.Seq++
+	token := r.token
+	r.mu.Unlock()
+
+	message := fmt.Sprintf("TOKEN:%d:%d:%s %s", token.Gen, token.Seq, token.Creator, r.node.Address)
+	for _, peer := range r.sucesores() {
+		if err := r.node.SendMessage(peer, message); err != nil {
+			r.node.Logger.Warn("sucesor caído, se salta", "algorithm", "token", "peer", peer, "error", err)
+			continue
+		}
+		r.mensaje()
+		return
+	}
+
+	// Ningún sucesor aceptó el token: conservarlo salvo que llegara uno más reciente
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.token == token && !r.cerrado {
+		r.tiene = true
+		r.pasando = true
+		time.AfterFunc(r.Timeout/4, func() {
+			r.mu.Lock()
+			r.pasando = false
+			r.mu.Unlock()
+			r.pasar()
+		})
+	}
+}
+
+// handleToken recibe el token y descarta los de generaciones anteriores. El
+// mensaje indica quién lo envía, y solo se acepta si tanto el remitente como
+// el creador son nodos del anillo: de lo contrario cualquier cliente podría
+// inyectar un token de una generación mayor. El remitente no tiene que ser el
+// predecesor inmediato, porque al pasar el token se saltan los sucesores caídos.
+func (r *TokenRing) handleToken(message string) {
+	parts := strings.SplitN(message, ":", 4)
+	if len(parts) != 4 {
+		r.node.Logger.Warn("token inválido", "message", message)
+		return
+	}
+	gen, errGen := strconv.Atoi(parts[1])
+	seq, errSeq := strconv.Atoi(parts[2])
+	creator, from, ok := strings.Cut(parts[3], " ")
+	if errGen != nil || errSeq != nil || !ok {
+		r.node.Logger.Warn("token inválido", "message", message)
+		return
+	}
+	anillo := r.anillo()
+	if from == r.node.Address || !slices.Contains(anillo, from) || !slices.Contains(anillo, creator) {
+		r.node.Logger.Warn("token de un nodo desconocido descartado", "algorithm", "token",
+			"from", from, "creator", creator)
+		return
+	}
+	token := tokenID{Gen: gen, Creator: creator, Seq: seq}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.token.menorQue(token) {
+		r.node.Logger.Debug("token duplicado o antiguo descartado", "algorithm", "token",
+			"generation", token.Gen, "seq", token.Seq, "current", r.token.Gen)
+		return
+	}
+	r.token = token
+	r.tiene = true
+	r.usar()
+}
+
+// handleProbe responde si el nodo tiene el token y hace cuánto lo vio
+func (r *TokenRing) handleProbe(conn net.Conn) {
+	r.mu.Lock()
+	reply := fmt.Sprintf("TOKEN_STATUS:%t:%d:%d:%s\n", r.tiene,
+		time.Since(r.visto).Milliseconds(), r.token.Gen, r.token.Creator)
+	r.mu.Unlock()
+
+	if _, err := fmt.Fprint(conn, reply); err == nil {
+		r.mensaje()
+	}
+}
+
+// detectar revisa periódicamente si el token se perdió. Cada nodo espera un
+// tiempo adicional según su posición en el anillo, para que normalmente sea
+// uno solo el que lo regenere.
+func (r *TokenRing) detectar(ctx context.Context) {
+	ticker := time.NewTicker(r.Timeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		anillo := r.anillo()
+		espera := r.Timeout + r.Timeout*time.Duration(slices.Index(anillo, r.node.Address))/time.Duration(len(anillo))
+
+		r.mu.Lock()
+		sospecha := !r.tiene && time.Since(r.visto) > espera
+		r.mu.Unlock()
+		if sospecha {
+			r.regenerar()
+		}
+	}
+}
+
+// regenerar consulta a los pares y genera un token nuevo si ninguno lo tiene
+// ni lo vio durante el último Timeout
+func (r *TokenRing) regenerar() {
+	vivo := false
+	mayor := 0 // Mayor generación conocida por los pares
+	for _, peer := range r.sucesores() {
+		reply, err := r.node.Request(peer, "TOKEN_PROBE")
+		r.mensaje()
+		if err != nil {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(reply, "TOKEN_STATUS:"), ":", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		tiene, _ := strconv.ParseBool(parts[0])
+		desde, _ := strconv.Atoi(parts[1])
+		gen, _ := strconv.Atoi(parts[2])
+		if tiene || time.Duration(desde)*time.Millisecond < r.Timeout {
+			vivo = true
+		}
+		mayor = max(mayor, gen)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if vivo || r.tiene || r.cerrado {
+		// El token sigue circulando: esperar otro Timeout antes de volver a sospechar
+		r.visto = time.Now()
+		return
+	}
+
+	r.token = tokenID{Gen: max(r.token.Gen, mayor) + 1, Creator: r.node.Address}
+	r.tiene = true
+	r.node.Logger.Warn("token perdido, se genera uno nuevo", "algorithm", "token", "generation", r.token.Gen)
+	r.usar()
+}
+
+func init() {
+	RegisterMutex("token", func(n *node.Node) Mutex { return NewTokenRing(n) })
+}
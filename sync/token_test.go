@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"log/slog"
+	"testing"
+
+	"solemne3_SO/node"
+)
+
+func TestTokenOrder(t *testing.T) {
+	// La generación manda sobre el creador, y este sobre los pasos
+	orden := []tokenID{
+		{Gen: 1, Creator: "b", Seq: 9},
+		{Gen: 2, Creator: "a", Seq: 5},
+		{Gen: 2, Creator: "b", Seq: 0},
+		{Gen: 2, Creator: "b", Seq: 1},
+		{Gen: 3, Creator: "a", Seq: 0},
+	}
+	for i := range orden {
+		if orden[i].menorQue(orden[i]) {
+			t.Errorf("%v es menor que sí mismo", orden[i])
+		}
+		for j := i + 1; j < len(orden); j++ {
+			if !orden[i].menorQue(orden[j]) || orden[j].menorQue(orden[i]) {
+				t.Errorf("se esperaba %v < %v", orden[i], orden[j])
+			}
+		}
+	}
+}
+
+// anilloDePrueba crea un anillo sin red que no pasa el token al recibirlo
+func anilloDePrueba() *TokenRing {
+	n := &node.Node{
+		Address: "localhost:8001",
+		Peers:   []string{"localhost:8000", "localhost:8001", "localhost:8002"},
+		Logger:  slog.New(slog.DiscardHandler),
+	}
+	return &TokenRing{node: n, token: tokenID{Gen: 2, Creator: "localhost:8000"}, cerrado: true}
+}
+
+func TestHandleTokenGenerations(t *testing.T) {
+	r := anilloDePrueba()
+
+	// Un token de una generación anterior se descarta
+	r.handleToken("TOKEN:1:50:localhost:8000 localhost:8000")
+	if r.tiene {
+		t.Fatal("se aceptó un token antiguo")
+	}
+
+	r.handleToken("TOKEN:3:0:localhost:8002 localhost:8000")
+	if !r.tiene || r.token != (tokenID{Gen: 3, Creator: "localhost:8002"}) {
+		t.Fatalf("token = %+v, tiene = %t", r.token, r.tiene)
+	}
+
+	// El mismo mensaje duplicado no vuelve a entregarse
+	r.tiene = false
+	r.handleToken("TOKEN:3:0:localhost:8002 localhost:8000")
+	if r.tiene {
+		t.Error("se aceptó un token duplicado")
+	}
+}
+
+func TestHandleTokenRejectsUnknownNodes(t *testing.T) {
+	for _, message := range []string{
+		"TOKEN:99:0:localhost:8000 localhost:9999", // Remitente desconocido
+		"TOKEN:99:0:localhost:9999 localhost:8000", // Creador desconocido
+		"TOKEN:99:0:localhost:8000 localhost:8001", // El propio nodo como remitente
+		"TOKEN:99:0:localhost:8000",                // Sin remitente
+	} {
+		r := anilloDePrueba()
+		r.handleToken(message)
+		if r.tiene || r.token.Gen != 2 {
+			t.Errorf("%q: se aceptó el token (generación %d)", message, r.token.Gen)
+		}
+	}
+}
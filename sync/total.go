@@ -0,0 +1,310 @@
+package sync
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	gosync "sync"
+
+	"solemne3_SO/metrics"
+	"solemne3_SO/node"
+)
+
+// TotalDeliverFunc recibe los mensajes de la multidifusión totalmente ordenada.
+// Todos los nodos reciben los mismos mensajes en el mismo orden.
+type TotalDeliverFunc func(from, content string, timestamp int)
+
+// mensajeTotal es un mensaje o un acuse de la multidifusión totalmente ordenada
+type mensajeTotal struct {
+	Kind      string `json:"kind"`    // "msg" o "ack"
+	From      string `json:"from"`    // Nodo que envía este mensaje
+	Seq       int    `json:"seq"`     // Secuencia del remitente (entrega FIFO)
+	Timestamp int    `json:"ts"`      // Reloj de Lamport del remitente
+	Sender    string `json:"sender"`  // Remitente original del mensaje confirmado
+	Stamp     int    `json:"stamp"`   // Marca del mensaje confirmado
+	Content   string `json:"content"` // Contenido (solo en "msg")
+}
+
+// idTotal identifica un mensaje por su marca de Lamport y su remitente
+type idTotal struct {
+	Stamp  int
+	Sender string
+}
+
+// TotalOrderMulticast entrega los mensajes a todos los nodos en el mismo orden,
+// ordenados por (marca de Lamport, remitente). Cada receptor confirma cada
+// mensaje a todos los nodos y un mensaje se entrega cuando encabeza la cola y
+// todos lo confirmaron. Supone canales confiables: un mensaje perdido detiene
+// las entregas.
+type TotalOrderMulticast struct {
+	node    *node.Node
+	reloj   *RelojLógico
+	deliver TotalDeliverFunc
+
+	mu         gosync.Mutex
+	seq        int                         // Último número de secuencia enviado
+	esperado   map[string]int              // Siguiente secuencia esperada de cada nodo
+	fuera      map[string][]mensajeTotal   // Mensajes recibidos antes de su turno
+	cola       colaTotal                   // Mensajes pendientes ordenados por marca
+	acks       map[idTotal]map[string]bool // Nodos que confirmaron cada mensaje
+	listos     []mensajeTotal              // Mensajes listos para entregar, en orden
+	entregando bool                        // Hay una entrega en curso
+}
+
+// NewTotalOrderMulticast crea la multidifusión totalmente ordenada de un nodo
+// sobre su reloj de Lamport y registra el manejador de mensajes TOTAL
+func NewTotalOrderMulticast(n *node.Node, deliver TotalDeliverFunc) *TotalOrderMulticast {
+	t := &TotalOrderMulticast{
+		node:     n,
+		reloj:    RelojDeNodo(n),
+		deliver:  deliver,
+		esperado: make(map[string]int),
+		fuera:    make(map[string][]mensajeTotal),
+		acks:     make(map[idTotal]map[string]bool),
+	}
+	n.RegisterHandler("TOTAL:", func(message string, conn net.Conn) {
+		t.handle(message)
+	})
+	return t
+}
+
+// Multicast envía un mensaje a todos los nodos, incluido el propio
+func (t *TotalOrderMulticast) Multicast(content string) error {
+	t.mu.Lock()
+	t.reloj.Incrementa()
+	stamp := t.reloj.Get()
+	msg := t.nuevo("msg", stamp, t.node.Address, content)
+	t.encolar(msg)
+	t.mu.Unlock()
+
+	err := t.enviar(msg)
+	t.entregar()
+	return err
+}
+
+// Pending retorna la cantidad de mensajes que esperan ser entregados
+func (t *TotalOrderMulticast) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cola.Len()
+}
+
+// Close elimina el manejador de mensajes TOTAL del nodo
+func (t *TotalOrderMulticast) Close() {
+	t.node.UnregisterHandler("TOTAL:")
+}
+
+// nuevo crea un mensaje con el siguiente número de secuencia. Debe llamarse con mu tomado.
+func (t *TotalOrderMulticast) nuevo(kind string, stamp int, sender, content string) mensajeTotal {
+	t.seq++
+	return mensajeTotal{
+		Kind:      kind,
+		From:      t.node.Address,
+		Seq:       t.seq,
+		Timestamp: t.reloj.Get(),
+		Sender:    sender,
+		Stamp:     stamp,
+		Content:   content,
+	}
+}
+
+// enviar manda un mensaje a todos los pares
+func (t *TotalOrderMulticast) enviar(msg mensajeTotal) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, peer := range peersOf(t.node) {
+		if err := t.node.SendMessage(peer, "TOTAL:"+string(data)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handle procesa un mensaje TOTAL recibido respetando el orden FIFO de cada remitente
+func (t *TotalOrderMulticast) handle(message string) {
+	var msg mensajeTotal
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, "TOTAL:")), &msg); err != nil || msg.From == "" {
+		t.node.Logger.Warn("mensaje de orden total inválido", "message", message)
+		return
+	}
+
+	t.mu.Lock()
+	esperado := t.esperado[msg.From] + 1
+	if msg.Seq < esperado || t.duplicado(msg) {
+		t.mu.Unlock()
+		return
+	}
+	t.fuera[msg.From] = append(t.fuera[msg.From], msg)
+
+	// Procesar los mensajes del remitente que ya están en secuencia
+	var acks []mensajeTotal
+	for {
+		i := t.buscar(msg.From, t.esperado[msg.From]+1)
+		if i < 0 {
+			break
+		}
+		next := t.fuera[msg.From][i]
+		t.fuera[msg.From] = append(t.fuera[msg.From][:i], t.fuera[msg.From][i+1:]...)
+		t.esperado[msg.From]++
+		if ack, ok := t.procesar(next); ok {
+			acks = append(acks, ack)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, ack := range acks {
+		if err := t.enviar(ack); err != nil {
+			t.node.Logger.Warn("no se pudo enviar confirmación", "algorithm", "total", "error", err)
+		}
+	}
+	t.entregar()
+}
+
+// duplicado indica si un mensaje ya está esperando su turno. Debe llamarse con mu tomado.
+func (t *TotalOrderMulticast) duplicado(msg mensajeTotal) bool {
+	return t.buscar(msg.From, msg.Seq) >= 0
+}
+
+// buscar retorna la posición del mensaje de un remitente con la secuencia
+// indicada entre los recibidos fuera de turno (-1 si no está)
+func (t *TotalOrderMulticast) buscar(from string, seq int) int {
+	for i, m := range t.fuera[from] {
+		if m.Seq == seq {
+			return i
+		}
+	}
+	return -1
+}
+
+// procesar aplica un mensaje en secuencia. Si es un mensaje nuevo retorna la
+// confirmación que debe enviarse a todos. Debe llamarse con mu tomado.
+func (t *TotalOrderMulticast) procesar(msg mensajeTotal) (mensajeTotal, bool) {
+	t.reloj.Sincroniza(msg.Timestamp)
+	metrics.LamportClock.Set(float64(t.reloj.Get()), t.node.Name)
+
+	id := idTotal{Stamp: msg.Stamp, Sender: msg.Sender}
+	if msg.Kind == "ack" {
+		t.confirmar(id, msg.From)
+		return mensajeTotal{}, false
+	}
+
+	// El remitente confirma implícitamente su propio mensaje
+	t.encolar(msg)
+	t.confirmar(id, msg.From)
+	return t.nuevo("ack", msg.Stamp, msg.Sender, ""), true
+}
+
+// encolar agrega un mensaje a la cola y lo confirma localmente. Debe llamarse con mu tomado.
+func (t *TotalOrderMulticast) encolar(msg mensajeTotal) {
+	heap.Push(&t.cola, msg)
+	t.confirmar(idTotal{Stamp: msg.Stamp, Sender: msg.Sender}, t.node.Address)
+}
+
+// confirmar registra la confirmación de un nodo y libera los mensajes que
+// encabezan la cola con todas sus confirmaciones. Debe llamarse con mu tomado.
+func (t *TotalOrderMulticast) confirmar(id idTotal, from string) {
+	if t.acks[id] == nil {
+		t.acks[id] = make(map[string]bool)
+	}
+	t.acks[id][from] = true
+
+	miembros := len(peersOf(t.node)) + 1
+	for t.cola.Len() > 0 {
+		head := t.cola[0]
+		headID := idTotal{Stamp: head.Stamp, Sender: head.Sender}
+		if len(t.acks[headID]) < miembros {
+			return
+		}
+		heap.Pop(&t.cola)
+		delete(t.acks, headID)
+		t.listos = append(t.listos, head)
+	}
+}
+
+// entregar llama al callback con los mensajes listos, en orden. Solo una
+// goroutine entrega a la vez; las demás dejan sus mensajes en la cola.
+func (t *TotalOrderMulticast) entregar() {
+	t.mu.Lock()
+	if t.entregando {
+		t.mu.Unlock()
+		return
+	}
+	t.entregando = true
+
+	for len(t.listos) > 0 {
+		msg := t.listos[0]
+		t.listos = t.listos[1:]
+		t.mu.Unlock()
+
+		if t.deliver != nil {
+			t.deliver(msg.Sender, msg.Content, msg.Stamp)
+		}
+
+		t.mu.Lock()
+	}
+	t.entregando = false
+	t.mu.Unlock()
+}
+
+// colaTotal es un min-heap de mensajes ordenados por (marca, remitente)
+type colaTotal []mensajeTotal
+
+func (c colaTotal) Len() int { return len(c) }
+func (c colaTotal) Less(i, j int) bool {
+	if c[i].Stamp != c[j].Stamp {
+		return c[i].Stamp < c[j].Stamp
+	}
+	return c[i].Sender < c[j].Sender
+}
+func (c colaTotal) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+
+func (c *colaTotal) Push(x any) { *c = append(*c, x.(mensajeTotal)) }
+
+func (c *colaTotal) Pop() any {
+	old := *c
+	msg := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return msg
+}
+
+func init() {
+	Register("total", func() Synchronizer { return &totalSynchronizer{} })
+}
+
+// totalSynchronizer envía un mensaje con orden total a todos los nodos en cada ronda
+type totalSynchronizer struct {
+	node      *node.Node
+	multicast *TotalOrderMulticast
+}
+
+func (s *totalSynchronizer) Name() string { return "total" }
+
+// Start crea la multidifusión del nodo, que muestra en el log cada entrega
+func (s *totalSynchronizer) Start(ctx context.Context, n *node.Node) error {
+	s.node = n
+	s.multicast = NewTotalOrderMulticast(n, func(from, content string, timestamp int) {
+		n.Logger.Info("mensaje entregado en orden total", "algorithm", "total",
+			"from", from, "content", content, "lamport", timestamp)
+	})
+	return nil
+}
+
+// SyncOnce envía un mensaje con orden total a todos los nodos
+func (s *totalSynchronizer) SyncOnce(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.multicast.Multicast("Hola desde " + s.node.Name)
+}
+
+// Stop elimina el manejador de mensajes TOTAL
+func (s *totalSynchronizer) Stop() error {
+	s.multicast.Close()
+	return nil
+}
@@ -1 +1,408 @@
 package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"solemne3_SO/node"
+)
+
+// RelojVectorial cuenta los mensajes entregados de cada nodo (por dirección)
+type RelojVectorial map[string]int
+
+// Copia retorna una copia independiente del reloj
+func (v RelojVectorial) Copia() RelojVectorial {
+	return maps.Clone(v)
+}
+
+// PrecedeA indica si v ocurrió antes que otro (v <= otro en todas las
+// componentes y distinto en al menos una)
+func (v RelojVectorial) PrecedeA(otro RelojVectorial) bool {
+	menor := false
+	for id, valor := range v {
+		if valor > otro[id] {
+			return false
+		}
+		if valor < otro[id] {
+			menor = true
+		}
+	}
+	for id, valor := range otro {
+		if _, ok := v[id]; !ok && valor > 0 {
+			menor = true
+		}
+	}
+	return menor
+}
+
+// CausalGapTimeout es el tiempo que un mensaje puede estar retenido antes de
+// pedir a su remitente que retransmita los mensajes que faltan
+var CausalGapTimeout = 2 * time.Second
+
+const (
+	// MaxCausalPending es la cantidad máxima de mensajes retenidos. Con la
+	// cola llena los mensajes nuevos que no se pueden entregar se descartan y
+	// se recuperan después con la retransmisión.
+	MaxCausalPending = 1000
+	// causalHistory es la cantidad de mensajes entregados que se guardan de
+	// cada nodo para retransmitirlos
+	causalHistory = 1000
+)
+
+// DeliverFunc recibe los mensajes de la difusión causal en orden causal
+type DeliverFunc func(from, content string, vector RelojVectorial)
+
+// mensajeCausal es un mensaje de la difusión causal tal como viaja por la red
+type mensajeCausal struct {
+	From    string         `json:"from"`
+	Vector  RelojVectorial `json:"vector"`
+	Content string         `json:"content"`
+}
+
+// solicitudCausal pide la retransmisión de los mensajes posteriores a Vector
+type solicitudCausal struct {
+	From   string         `json:"from"`
+	Vector RelojVectorial `json:"vector"`
+}
+
+// retenidoCausal es un mensaje retenido junto con su hora de llegada
+type retenidoCausal struct {
+	mensajeCausal
+	llegada time.Time
+}
+
+// CausalBroadcast difunde mensajes con marca de reloj vectorial y los entrega
+// respetando la causalidad: un mensaje se retiene hasta que se hayan
+// entregado todos los mensajes que lo preceden causalmente.
+//
+// Los mensajes perdidos se recuperan con retransmisiones: si un mensaje pasa
+// más de CausalGapTimeout retenido, el nodo envía su reloj vectorial al
+// remitente (CAUSAL_RESEND) y este reenvía los mensajes entregados que el nodo
+// no tiene, tomados de los últimos causalHistory de cada origen. Como la
+// pérdida del último mensaje de un nodo no deja ningún mensaje retenido, cada
+// CausalGapTimeout el nodo envía además su reloj a todos los pares. Si el
+// faltante ya salió del historial de los pares, los mensajes que dependen de
+// él siguen retenidos.
+//
+// Solo se aceptan mensajes de los nodos configurados, y cuyo reloj vectorial
+// no mencione a otros nodos: una entrada desconocida nunca se cumpliría y
+// retendría el mensaje para siempre.
+type CausalBroadcast struct {
+	node    *node.Node
+	deliver DeliverFunc
+	cancel  context.CancelFunc
+
+	mu         gosync.Mutex
+	reloj      RelojVectorial             // Mensajes entregados de cada nodo
+	retenidos  []retenidoCausal           // Mensajes que esperan a sus predecesores
+	listos     []mensajeCausal            // Mensajes listos para entregar, en orden
+	historial  map[string][]mensajeCausal // Últimos mensajes entregados de cada origen
+	entregando bool                       // Hay una entrega en curso
+}
+
+// NewCausalBroadcast crea la difusión causal de un nodo y registra el
+// manejador de mensajes CAUSAL e inicia la detección de mensajes faltantes.
+// deliver se llama una vez por mensaje, incluidos los propios, y puede
+// difundir nuevos mensajes.
+func NewCausalBroadcast(n *node.Node, deliver DeliverFunc) *CausalBroadcast {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &CausalBroadcast{
+		node:      n,
+		deliver:   deliver,
+		cancel:    cancel,
+		reloj:     make(RelojVectorial),
+		historial: make(map[string][]mensajeCausal),
+	}
+	n.RegisterHandler("CAUSAL:", func(message string, conn net.Conn) {
+		c.handle(message)
+	})
+	n.RegisterHandler("CAUSAL_RESEND:", func(message string, conn net.Conn) {
+		c.handleResend(message)
+	})
+	go c.detectar(ctx)
+	return c
+}
+
+// Broadcast difunde un mensaje a todos los pares
+func (c *CausalBroadcast) Broadcast(content string) error {
+	c.mu.Lock()
+	c.reloj[c.node.Address]++
+	msg := mensajeCausal{From: c.node.Address, Vector: c.reloj.Copia(), Content: content}
+	c.listos = append(c.listos, msg)
+	c.guardar(msg)
+	c.mu.Unlock()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, peer := range peersOf(c.node) {
+		if err := c.node.SendMessage(peer, "CAUSAL:"+string(data)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	c.entregar()
+	return errors.Join(errs...)
+}
+
+// Vector retorna una copia del reloj vectorial de mensajes entregados
+func (c *CausalBroadcast) Vector() RelojVectorial {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reloj.Copia()
+}
+
+// Pending retorna la cantidad de mensajes retenidos a la espera de sus predecesores
+func (c *CausalBroadcast) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.retenidos)
+}
+
+// Close detiene la detección de mensajes faltantes y elimina los manejadores del nodo
+func (c *CausalBroadcast) Close() {
+	c.cancel()
+	c.node.UnregisterHandler("CAUSAL:")
+	c.node.UnregisterHandler("CAUSAL_RESEND:")
+}
+
+// handle procesa un mensaje CAUSAL recibido
+func (c *CausalBroadcast) handle(message string) {
+	var msg mensajeCausal
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, "CAUSAL:")), &msg); err != nil || msg.From == "" {
+		c.node.Logger.Warn("mensaje causal inválido", "message", message)
+		return
+	}
+	miembros := miembros(c.node)
+	if msg.From == c.node.Address || !slices.Contains(miembros, msg.From) {
+		c.node.Logger.Warn("mensaje causal de un nodo desconocido", "from", msg.From)
+		return
+	}
+	for id := range msg.Vector {
+		if !slices.Contains(miembros, id) {
+			c.node.Logger.Warn("mensaje causal con un nodo desconocido en el reloj", "from", msg.From, "node_id", id)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	if msg.Vector[msg.From] <= c.reloj[msg.From] || c.retenido(msg) {
+		// Mensaje duplicado o ya entregado
+		c.mu.Unlock()
+		return
+	}
+	if len(c.retenidos) >= MaxCausalPending && !c.entregable(msg) {
+		// Se recupera con la retransmisión cuando se entreguen sus predecesores
+		c.node.Logger.Warn("cola de mensajes causales llena, mensaje descartado",
+			"from", msg.From, "pending", len(c.retenidos))
+		c.mu.Unlock()
+		return
+	}
+	c.retenidos = append(c.retenidos, retenidoCausal{mensajeCausal: msg, llegada: time.Now()})
+	c.liberar()
+	if len(c.retenidos) > 0 {
+		c.node.Logger.Debug("mensajes causales retenidos", "pending", len(c.retenidos), "vector", c.reloj)
+	}
+	c.mu.Unlock()
+
+	c.entregar()
+}
+
+// liberar mueve a listos los mensajes retenidos cuyos predecesores ya se
+// entregaron. Debe llamarse con mu tomado.
+func (c *CausalBroadcast) liberar() {
+	for avance := true; avance; {
+		avance = false
+		for i, r := range c.retenidos {
+			if !c.entregable(r.mensajeCausal) {
+				continue
+			}
+			c.reloj[r.From]++
+			c.listos = append(c.listos, r.mensajeCausal)
+			c.guardar(r.mensajeCausal)
+			c.retenidos = append(c.retenidos[:i], c.retenidos[i+1:]...)
+			avance = true
+			break
+		}
+	}
+}
+
+// retenido indica si el mensaje ya está en la cola de retenidos. Debe
+// llamarse con mu tomado.
+func (c *CausalBroadcast) retenido(msg mensajeCausal) bool {
+	for _, r := range c.retenidos {
+		if r.From == msg.From && r.Vector[r.From] == msg.Vector[msg.From] {
+			return true
+		}
+	}
+	return false
+}
+
+// guardar agrega un mensaje entregado al historial de su origen. Debe
+// llamarse con mu tomado.
+func (c *CausalBroadcast) guardar(msg mensajeCausal) {
+	h := append(c.historial[msg.From], msg)
+	if len(h) > causalHistory {
+		h = h[len(h)-causalHistory:]
+	}
+	c.historial[msg.From] = h
+}
+
+// detectar revisa periódicamente los mensajes retenidos y pide la
+// retransmisión de los faltantes a los remitentes de los que llevan más de
+// CausalGapTimeout esperando. El remitente ya entregó todos los predecesores
+// del mensaje, por lo que puede reenviarlos. Una de cada dos revisiones la
+// pide a todos los pares, para recuperar también el último mensaje de cada uno.
+func (c *CausalBroadcast) detectar(ctx context.Context) {
+	ticker := time.NewTicker(CausalGapTimeout / 2)
+	defer ticker.Stop()
+	for ronda := 1; ; ronda++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		var remitentes []string
+		if ronda%2 == 0 {
+			remitentes = peersOf(c.node)
+		}
+		for _, r := range c.retenidos {
+			if time.Since(r.llegada) > CausalGapTimeout && !slices.Contains(remitentes, r.From) {
+				remitentes = append(remitentes, r.From)
+			}
+		}
+		data, err := json.Marshal(solicitudCausal{From: c.node.Address, Vector: c.reloj})
+		c.mu.Unlock()
+		if err != nil {
+			continue
+		}
+
+		for _, peer := range remitentes {
+			c.node.Logger.Debug("solicitando retransmisión de mensajes causales", "peer", peer)
+			c.node.SendMessage(peer, "CAUSAL_RESEND:"+string(data))
+		}
+	}
+}
+
+// handleResend reenvía al solicitante los mensajes del historial que todavía
+// no entregó, en orden de cada origen
+func (c *CausalBroadcast) handleResend(message string) {
+	var req solicitudCausal
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(message, "CAUSAL_RESEND:")), &req); err != nil || req.From == "" {
+		c.node.Logger.Warn("solicitud de retransmisión inválida", "message", message)
+		return
+	}
+	if !slices.Contains(peersOf(c.node), req.From) {
+		c.node.Logger.Warn("solicitud de retransmisión de un nodo desconocido", "from", req.From)
+		return
+	}
+
+	c.mu.Lock()
+	var faltantes []mensajeCausal
+	for origen, mensajes := range c.historial {
+		for _, msg := range mensajes {
+			if msg.Vector[origen] > req.Vector[origen] {
+				faltantes = append(faltantes, msg)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for _, msg := range faltantes[:min(len(faltantes), MaxCausalPending)] {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		if err := c.node.SendMessage(req.From, "CAUSAL:"+string(data)); err != nil {
+			return
+		}
+	}
+}
+
+// entregable indica si un mensaje es el siguiente de su remitente y todos los
+// mensajes que el remitente había entregado ya se entregaron aquí
+func (c *CausalBroadcast) entregable(msg mensajeCausal) bool {
+	for id, valor := range msg.Vector {
+		if id == msg.From {
+			if valor != c.reloj[id]+1 {
+				return false
+			}
+		} else if valor > c.reloj[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// entregar llama al callback con los mensajes listos, en orden. Solo una
+// goroutine entrega a la vez; las demás dejan sus mensajes en la cola.
+func (c *CausalBroadcast) entregar() {
+	c.mu.Lock()
+	if c.entregando {
+		c.mu.Unlock()
+		return
+	}
+	c.entregando = true
+
+	for len(c.listos) > 0 {
+		msg := c.listos[0]
+		c.listos = c.listos[1:]
+		c.mu.Unlock()
+
+		if c.deliver != nil {
+			c.deliver(msg.From, msg.Content, msg.Vector)
+		}
+
+		c.mu.Lock()
+	}
+	c.entregando = false
+	c.mu.Unlock()
+}
+
+func init() {
+	Register("vector", func() Synchronizer { return &vectorSynchronizer{} })
+}
+
+// vectorSynchronizer difunde un mensaje causal a los pares en cada ronda
+type vectorSynchronizer struct {
+	node      *node.Node
+	broadcast *CausalBroadcast
+}
+
+func (s *vectorSynchronizer) Name() string { return "vector" }
+
+// Start crea la difusión causal del nodo, que muestra en el log cada entrega
+func (s *vectorSynchronizer) Start(ctx context.Context, n *node.Node) error {
+	s.node = n
+	s.broadcast = NewCausalBroadcast(n, func(from, content string, vector RelojVectorial) {
+		n.Logger.Info("mensaje entregado en orden causal", "algorithm", "vector",
+			"from", from, "content", content, "vector", vector)
+	})
+	return nil
+}
+
+// SyncOnce difunde un mensaje con el reloj vectorial
+func (s *vectorSynchronizer) SyncOnce(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.broadcast.Broadcast("Hola desde " + s.node.Name)
+}
+
+// Stop detiene la difusión causal y elimina sus manejadores
+func (s *vectorSynchronizer) Stop() error {
+	s.broadcast.Close()
+	return nil
+}
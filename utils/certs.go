@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Nombres de archivo de la autoridad certificadora del clúster
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+)
+
+// CertValidity es la vigencia de los certificados generados
+var CertValidity = 365 * 24 * time.Hour
+
+// GenerateCA crea la autoridad certificadora del clúster en el directorio indicado
+func GenerateCA(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "solemne3 cluster CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(CertValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	return writeKeyPair(dir, caCertFile, caKeyFile, der, key)
+}
+
+// EnsureCA reutiliza la autoridad certificadora del directorio si ya existe,
+// para no invalidar los certificados emitidos con ella, y la crea si no hay
+// ninguna. Con force la crea de nuevo siempre. Retorna si la CA se creó.
+func EnsureCA(dir string, force bool) (bool, error) {
+	if !force {
+		_, errCert := os.Stat(filepath.Join(dir, caCertFile))
+		_, errKey := os.Stat(filepath.Join(dir, caKeyFile))
+		if !errors.Is(errCert, fs.ErrNotExist) || !errors.Is(errKey, fs.ErrNotExist) {
+			// Una CA existente que no se puede leer no se reemplaza en silencio
+			if _, _, err := loadCA(dir); err != nil {
+				return false, fmt.Errorf("%w (use --force para reemplazarla)", err)
+			}
+			return false, nil
+		}
+	}
+	return true, GenerateCA(dir)
+}
+
+// GenerateNodeCertificate emite un certificado para la dirección de un nodo,
+// firmado por la autoridad certificadora existente en el directorio
+func GenerateNodeCertificate(dir, address string) error {
+	caCert, caKey, err := loadCA(dir)
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("dirección inválida %s: %w", address, err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: address},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(CertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	// El certificado es válido tanto como servidor como cliente del host
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	base := certBaseName(address)
+	return writeKeyPair(dir, base+".crt", base+".key", der, key)
+}
+
+// LoadNodeTLSConfig construye la configuración TLS mutua de un nodo:
+// presenta su propio certificado y exige que los pares estén firmados por la CA
+func LoadNodeTLSConfig(dir, address string) (*tls.Config, error) {
+	base := certBaseName(address)
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, base+".crt"), filepath.Join(dir, base+".key"))
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo cargar el certificado de %s: %w", address, err)
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(dir, caCertFile))
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo cargar la CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("certificado de CA inválido")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// certBaseName convierte una dirección host:puerto en un nombre de archivo
+func certBaseName(address string) string {
+	return strings.NewReplacer(":", "_", "/", "_").Replace(address)
+}
+
+// loadCA lee el certificado y la clave privada de la CA
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, caCertFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("no se pudo leer la CA: %w", err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("no se pudo leer la clave de la CA: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("archivos de CA inválidos")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// writeKeyPair guarda un certificado y su clave privada en formato PEM
+func writeKeyPair(dir, certName, keyName string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, certName), certPEM, 0o644); err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return os.WriteFile(filepath.Join(dir, keyName), keyPEM, 0o600)
+}
+
+// randomSerial genera un número de serie aleatorio de 128 bits
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyVersion es una clave simétrica identificada por su huella
+type KeyVersion struct {
+	ID      string    // Huella de la clave (primeros 4 bytes de SHA-256 en hex)
+	Key     []byte    // Clave AES-256
+	Created time.Time // Momento en que se agregó al llavero
+}
+
+// Keyring guarda claves simétricas versionadas. La última clave agregada se
+// usa para cifrar y las anteriores se conservan para descifrar mensajes en tránsito.
+type Keyring struct {
+	mu       sync.RWMutex
+	versions []KeyVersion // Ordenadas de la más antigua a la más reciente
+	retain   int          // Cantidad máxima de versiones conservadas
+}
+
+// NewKeyring crea un llavero vacío que conserva hasta retain versiones
+func NewKeyring(retain int) *Keyring {
+	if retain <= 0 {
+		retain = 3
+	}
+	return &Keyring{retain: retain}
+}
+
+// KeyID calcula el identificador de una clave
+func KeyID(key []byte) string {
+	hash := sha256.Sum256(key)
+	return hex.EncodeToString(hash[:4])
+}
+
+// Add agrega una clave como versión actual y retorna su identificador
+func (k *Keyring) Add(key []byte) (string, error) {
+	if len(key) != 32 {
+		return "", errors.New("la clave debe tener 32 bytes")
+	}
+
+	id := KeyID(key)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Una clave repetida pasa a ser la actual sin duplicarse
+	for i, v := range k.versions {
+		if v.ID == id {
+			k.versions = append(k.versions[:i], k.versions[i+1:]...)
+			break
+		}
+	}
+
+	k.versions = append(k.versions, KeyVersion{ID: id, Key: append([]byte(nil), key...), Created: time.Now()})
+	if len(k.versions) > k.retain {
+		k.versions = k.versions[len(k.versions)-k.retain:]
+	}
+	return id, nil
+}
+
+// Rotate genera una clave aleatoria nueva y la deja como actual
+func (k *Keyring) Rotate() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return k.Add(key)
+}
+
+// Current retorna la versión de clave usada para cifrar
+func (k *Keyring) Current() (KeyVersion, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.versions) == 0 {
+		return KeyVersion{}, false
+	}
+	return k.versions[len(k.versions)-1], true
+}
+
+// Versions retorna los identificadores conservados, del más antiguo al actual
+func (k *Keyring) Versions() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]string, len(k.versions))
+	for i, v := range k.versions {
+		ids[i] = v.ID
+	}
+	return ids
+}
+
+// Encrypt cifra con la clave actual. El resultado tiene la forma "<id>.<base64>"
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	current, ok := k.Current()
+	if !ok {
+		return "", errors.New("llavero sin claves")
+	}
+
+	ciphertext, err := sealAESGCM(current.Key, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return current.ID + "." + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt descifra un mensaje con la versión de clave indicada en su prefijo
+func (k *Keyring) Decrypt(cipherText string) (string, error) {
+	id, encoded, ok := strings.Cut(cipherText, ".")
+	if !ok {
+		return "", errors.New("formato de mensaje cifrado inválido")
+	}
+
+	key, ok := k.lookup(id)
+	if !ok {
+		return "", fmt.Errorf("versión de clave desconocida: %s", id)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := openAESGCM(key, data)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// lookup busca una clave por su identificador
+func (k *Keyring) lookup(id string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, v := range k.versions {
+		if v.ID == id {
+			return v.Key, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PasswordStore guarda los hashes de contraseña de los usuarios en un archivo
+// de texto con una línea "usuario:hash" por usuario
+type PasswordStore struct {
+	mu     sync.Mutex
+	path   string            // Archivo donde se persisten los hashes
+	hashes map[string]string // Usuario -> hash
+}
+
+// dummyPasswordHash se usa para igualar el tiempo de respuesta ante usuarios inexistentes
+var dummyPasswordHash = sync.OnceValue(func() string { return HashPassword("") })
+
+// LoadPasswordStore carga los usuarios desde un archivo (vacío si no existe)
+func LoadPasswordStore(path string) (*PasswordStore, error) {
+	store := &PasswordStore{path: path, hashes: make(map[string]string)}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(text, ":")
+		if !ok || user == "" || hash == "" {
+			return nil, fmt.Errorf("%s:%d: línea inválida", path, line)
+		}
+		store.hashes[user] = hash
+	}
+	return store, scanner.Err()
+}
+
+// Authenticate verifica las credenciales de un usuario. Si el hash guardado
+// está en un formato antiguo se reemplaza por uno nuevo y se persiste. La
+// verificación (costosa) se hace sin el candado tomado para no serializar los
+// inicios de sesión.
+func (s *PasswordStore) Authenticate(user, password string) bool {
+	s.mu.Lock()
+	hash, ok := s.hashes[user]
+	s.mu.Unlock()
+
+	if !ok {
+		// Se verifica igualmente para no revelar qué usuarios existen
+		VerifyPassword(password, dummyPasswordHash())
+		return false
+	}
+
+	valid, upgraded := VerifyAndUpgrade(password, hash)
+	if !valid {
+		return false
+	}
+
+	if upgraded != "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// Si la contraseña cambió durante la verificación se conserva la nueva
+		if s.hashes[user] == hash {
+			s.hashes[user] = upgraded
+			if err := s.save(); err != nil {
+				slog.Error("error guardando hash actualizado", "user", user, "error", err)
+			}
+		}
+	}
+	return true
+}
+
+// SetPassword crea o reemplaza la contraseña de un usuario y persiste el archivo
+func (s *PasswordStore) SetPassword(user, password string) error {
+	if user == "" || strings.Contains(user, ":") {
+		return errors.New("nombre de usuario inválido")
+	}
+
+	hash := HashPassword(password)
+	if hash == "" {
+		return errors.New("no se pudo calcular el hash")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[user] = hash
+	return s.save()
+}
+
+// save escribe el archivo completo de forma atómica
+func (s *PasswordStore) save() error {
+	users := make([]string, 0, len(s.hashes))
+	for user := range s.hashes {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	var b strings.Builder
+	for _, user := range users {
+		b.WriteString(user + ":" + s.hashes[user] + "\n")
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
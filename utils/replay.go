@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReplayCache recuerda los mensajes seguros ya aceptados para rechazar repeticiones
+type ReplayCache struct {
+	mu         sync.Mutex
+	window     time.Duration           // Ventana de frescura de los mensajes
+	maxEntries int                     // Cantidad máxima de mensajes recordados
+	seen       map[replayKey]time.Time // Mensaje visto -> expiración
+	expiries   expiryHeap              // Entradas ordenadas por expiración
+}
+
+// NewReplayCache crea una caché con la ventana de frescura y el tamaño máximo indicados
+func NewReplayCache(window time.Duration, maxEntries int) *ReplayCache {
+	if window <= 0 {
+		window = MessageWindow
+	}
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &ReplayCache{
+		window:     window,
+		maxEntries: maxEntries,
+		seen:       make(map[replayKey]time.Time),
+	}
+}
+
+// Window retorna la ventana de frescura usada por la caché
+func (c *ReplayCache) Window() time.Duration {
+	return c.window
+}
+
+// Verify valida firma, frescura y unicidad de un mensaje seguro.
+// Un mensaje solo se registra como visto si pasa todas las validaciones.
+func (c *ReplayCache) Verify(msg *SecureMessage, key string) error {
+	if err := verifySecureMessage(msg, key, c.window); err != nil {
+		return err
+	}
+	if msg.Nonce == "" {
+		return errors.New("mensaje sin nonce")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.prune(now)
+
+	id := replayKey{from: msg.From, nonce: msg.Nonce}
+	if _, ok := c.seen[id]; ok {
+		return errors.New("mensaje repetido")
+	}
+
+	// Si la caché sigue llena con entradas vigentes no se puede garantizar
+	// la detección de repeticiones, por lo que se rechaza el mensaje
+	if len(c.seen) >= c.maxEntries {
+		return errors.New("caché de mensajes llena")
+	}
+
+	expiry := time.Unix(msg.Timestamp, 0).Add(c.window)
+	c.seen[id] = expiry
+	heap.Push(&c.expiries, expiryEntry{id: id, expiry: expiry})
+
+	return nil
+}
+
+// Len retorna la cantidad de mensajes recordados actualmente
+func (c *ReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+// prune elimina las entradas cuya ventana de frescura ya terminó
+func (c *ReplayCache) prune(now time.Time) {
+	for c.expiries.Len() > 0 && !c.expiries[0].expiry.After(now) {
+		entry := heap.Pop(&c.expiries).(expiryEntry)
+		delete(c.seen, entry.id)
+	}
+}
+
+// replayKey identifica un mensaje visto por su remitente y su nonce. Se
+// guardan por separado para que un remitente con ":" no pueda hacerse pasar
+// por otro nonce.
+type replayKey struct {
+	from  string
+	nonce string
+}
+
+// expiryEntry asocia un mensaje visto con el instante en que expira
+type expiryEntry struct {
+	id     replayKey
+	expiry time.Time
+}
+
+// expiryHeap es un min-heap de entradas ordenadas por expiración
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiry.Before(h[j].expiry) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *expiryHeap) Push(x any) { *h = append(*h, x.(expiryEntry)) }
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -1,16 +1,21 @@
 package utils
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -20,27 +25,11 @@ func EncryptMessage(message string, key string) string {
 	// Derivar clave de 32 bytes usando SHA-256
 	hash := sha256.Sum256([]byte(key))
 
-	// Crear bloque AES
-	block, err := aes.NewCipher(hash[:])
-	if err != nil {
-		return ""
-	}
-
-	// Crear GCM
-	gcm, err := cipher.NewGCM(block)
+	ciphertext, err := sealAESGCM(hash[:], []byte(message))
 	if err != nil {
 		return ""
 	}
 
-	// Generar nonce aleatorio
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return ""
-	}
-
-	// Cifrar el mensaje
-	ciphertext := gcm.Seal(nonce, nonce, []byte(message), nil)
-
 	// Retornar en base64
 	return base64.StdEncoding.EncodeToString(ciphertext)
 }
@@ -56,49 +45,80 @@ func DecryptMessage(cipherText string, key string) string {
 	// Derivar clave de 32 bytes usando SHA-256
 	hash := sha256.Sum256([]byte(key))
 
-	// Crear bloque AES
-	block, err := aes.NewCipher(hash[:])
+	plaintext, err := openAESGCM(hash[:], data)
 	if err != nil {
 		return ""
 	}
 
+	return string(plaintext)
+}
+
+// sealAESGCM cifra con AES-GCM y antepone el nonce aleatorio al resultado
+func sealAESGCM(key, plaintext []byte) ([]byte, error) {
+	// Crear bloque AES
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
 	// Crear GCM
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return ""
+		return nil, err
+	}
+
+	// Generar nonce aleatorio
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	// Cifrar el mensaje
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openAESGCM descifra datos producidos por sealAESGCM
+func openAESGCM(key, data []byte) ([]byte, error) {
+	// Crear bloque AES
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Crear GCM
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
 	}
 
 	// Verificar tamaño mínimo
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
-		return ""
+		return nil, errors.New("mensaje cifrado demasiado corto")
 	}
 
 	// Extraer nonce y ciphertext
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
 
 	// Descifrar
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return ""
-	}
-
-	return string(plaintext)
+	return gcm.Open(nil, nonce, ciphertext, nil)
 }
 
-// GenerateToken genera un token simple basado en timestamp y clave
+// TokenTTL es la vigencia de los tokens generados con GenerateToken
+var TokenTTL = time.Hour
+
+// GenerateToken genera un token con el identificador, la hora de emisión y
+// una firma HMAC-SHA256 con la clave
 func GenerateToken(nodeID string, secretKey string) string {
 	timestamp := time.Now().Unix()
 	data := fmt.Sprintf("%s:%d", nodeID, timestamp)
-
-	// Crear hash del token
-	hash := sha256.Sum256([]byte(data + secretKey))
-	token := fmt.Sprintf("%s.%s", data, hex.EncodeToString(hash[:16]))
-
+	token := fmt.Sprintf("%s.%s", data, signToken(data, secretKey))
 	return base64.StdEncoding.EncodeToString([]byte(token))
 }
 
-// ValidateToken valida un token generado previamente
+// ValidateToken valida un token generado previamente y que no haya vencido
+// (más antiguo que TokenTTL). El identificador puede contener "." y ":"
+// porque la firma y la hora se separan desde el final.
 func ValidateToken(token string, secretKey string) (bool, string) {
 	// Decodificar base64
 	decoded, err := base64.StdEncoding.DecodeString(token)
@@ -106,33 +126,59 @@ func ValidateToken(token string, secretKey string) (bool, string) {
 		return false, ""
 	}
 
-	// Dividir token en partes
-	parts := strings.Split(string(decoded), ".")
-	if len(parts) != 2 {
+	// Separar datos y firma
+	data, receivedHash, ok := cutLast(string(decoded), ".")
+	if !ok {
 		return false, ""
 	}
 
-	data, receivedHash := parts[0], parts[1]
-
-	// Recrear hash esperado
-	hash := sha256.Sum256([]byte(data + secretKey))
-	expectedHash := hex.EncodeToString(hash[:16])
-
-	// Verificar hash
-	if receivedHash != expectedHash {
+	// Verificar firma en tiempo constante
+	if !hmac.Equal([]byte(receivedHash), []byte(signToken(data, secretKey))) {
 		return false, ""
 	}
 
-	// Extraer nodeID del data
-	dataParts := strings.Split(data, ":")
-	if len(dataParts) != 2 {
+	// Extraer nodeID y hora de emisión
+	nodeID, issued, ok := cutLast(data, ":")
+	if !ok {
+		return false, ""
+	}
+	timestamp, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return false, ""
+	}
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > TokenTTL || age < -time.Minute {
 		return false, ""
 	}
 
-	nodeID := dataParts[0]
 	return true, nodeID
 }
 
+// signToken calcula la firma HMAC-SHA256 de los datos de un token
+func signToken(data, secretKey string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// cutLast separa s en la última aparición de sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// nodeIDKey es la clave del contexto donde se guarda el nodo autenticado
+type nodeIDKey struct{}
+
+// NodeIDFromContext obtiene el identificador autenticado por ValidateTokenMiddleware
+func NodeIDFromContext(ctx context.Context) (string, bool) {
+	nodeID, ok := ctx.Value(nodeIDKey{}).(string)
+	return nodeID, ok
+}
+
 // ValidateTokenMiddleware middleware para validar tokens en peticiones HTTP
 func ValidateTokenMiddleware(secretKey string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -160,23 +206,92 @@ func ValidateTokenMiddleware(secretKey string) func(http.Handler) http.Handler {
 			}
 
 			// Agregar nodeID al contexto de la petición
-			r.Header.Set("X-Node-ID", nodeID)
+			ctx := context.WithValue(r.Context(), nodeIDKey{}, nodeID)
 
 			// Continuar con el siguiente handler
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// HashPassword crea un hash simple de una contraseña (para demostración)
+// PasswordIterations es la cantidad de iteraciones PBKDF2 para hashes nuevos
+var PasswordIterations = 600000
+
+// passwordAlgorithm identifica el formato de hash actual
+const passwordAlgorithm = "pbkdf2-sha256"
+
+// HashPassword crea un hash PBKDF2-SHA256 con sal aleatoria.
+// El formato es autodescriptivo: pbkdf2-sha256$<iteraciones>$<sal>$<hash>
 func HashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return ""
+	}
+
+	derived, err := pbkdf2.Key(sha256.New, password, salt, PasswordIterations, 32)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordAlgorithm, PasswordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(derived))
 }
 
-// VerifyPassword verifica una contraseña contra su hash
+// VerifyPassword verifica una contraseña contra su hash en tiempo constante.
+// Acepta tanto el formato PBKDF2 como el SHA-256 sin sal anterior.
 func VerifyPassword(password, hash string) bool {
-	return HashPassword(password) == hash
+	if !strings.HasPrefix(hash, passwordAlgorithm+"$") {
+		legacy := sha256.Sum256([]byte(password))
+		expected := hex.EncodeToString(legacy[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	derived, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(derived, expected) == 1
+}
+
+// NeedsRehash indica si un hash usa un formato antiguo o menos iteraciones
+// que las configuradas actualmente
+func NeedsRehash(hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordAlgorithm {
+		return true
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	return err != nil || iterations < PasswordIterations
+}
+
+// VerifyAndUpgrade verifica una contraseña y, si su hash está desactualizado,
+// retorna además un hash nuevo que debe reemplazar al almacenado
+func VerifyAndUpgrade(password, hash string) (bool, string) {
+	if !VerifyPassword(password, hash) {
+		return false, ""
+	}
+	if NeedsRehash(hash) {
+		return true, HashPassword(password)
+	}
+	return true, ""
 }
 
 // SecureMessage estructura para mensajes seguros entre nodos
@@ -185,46 +300,80 @@ type SecureMessage struct {
 	To        string `json:"to"`
 	Content   string `json:"content"`
 	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
 	Signature string `json:"signature"`
 }
 
-// CreateSecureMessage crea un mensaje seguro y firmado
-func CreateSecureMessage(from, to, content, key string) *SecureMessage {
+// MessageWindow es la antigüedad máxima aceptada para un mensaje seguro
+var MessageWindow = 300 * time.Second
+
+// CreateSecureMessage crea un mensaje seguro y firmado. Falla si no se puede
+// generar el nonce, porque un mensaje sin nonce nunca se aceptaría.
+func CreateSecureMessage(from, to, content, key string) (*SecureMessage, error) {
+	nonce, err := generateNonce()
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo generar el nonce: %w", err)
+	}
 	msg := &SecureMessage{
 		From:      from,
 		To:        to,
 		Content:   content,
 		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
 	}
 
 	// Crear firma del mensaje
-	data := fmt.Sprintf("%s:%s:%s:%d", from, to, content, msg.Timestamp)
-	hash := sha256.Sum256([]byte(data + key))
-	msg.Signature = hex.EncodeToString(hash[:])
+	msg.Signature = signSecureMessage(msg, key)
 
-	return msg
+	return msg, nil
 }
 
 // VerifySecureMessage verifica la integridad de un mensaje seguro
 func VerifySecureMessage(msg *SecureMessage, key string) error {
+	return verifySecureMessage(msg, key, MessageWindow)
+}
+
+// verifySecureMessage comprueba firma y frescura usando la ventana indicada
+func verifySecureMessage(msg *SecureMessage, key string, window time.Duration) error {
 	if msg == nil {
 		return errors.New("mensaje nulo")
 	}
 
-	// Recrear firma esperada
-	data := fmt.Sprintf("%s:%s:%s:%d", msg.From, msg.To, msg.Content, msg.Timestamp)
-	hash := sha256.Sum256([]byte(data + key))
-	expectedSignature := hex.EncodeToString(hash[:])
-
 	// Verificar firma
-	if msg.Signature != expectedSignature {
+	expectedSignature := signSecureMessage(msg, key)
+	if !hmac.Equal([]byte(msg.Signature), []byte(expectedSignature)) {
 		return errors.New("firma inválida")
 	}
 
-	// Verificar timestamp (no más de 5 minutos de antigüedad)
-	if time.Now().Unix()-msg.Timestamp > 300 {
+	// Verificar timestamp (ni más antiguo que la ventana ni del futuro)
+	age := time.Since(time.Unix(msg.Timestamp, 0))
+	if age > window {
 		return errors.New("mensaje expirado")
 	}
+	if age < -window {
+		return errors.New("mensaje con timestamp futuro")
+	}
 
 	return nil
 }
+
+// signSecureMessage calcula la firma HMAC-SHA256 de un mensaje seguro. Cada
+// campo se firma precedido de su largo, para que no se pueda mover texto de
+// un campo a otro (por ejemplo, From "a:b" y To "c" frente a From "a" y To
+// "b:c") sin invalidar la firma.
+func signSecureMessage(msg *SecureMessage, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	for _, field := range []string{msg.From, msg.To, msg.Content, strconv.FormatInt(msg.Timestamp, 10), msg.Nonce} {
+		fmt.Fprintf(mac, "%d:%s,", len(field), field)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateNonce genera un identificador aleatorio de 16 bytes en hexadecimal
+func generateNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
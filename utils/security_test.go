@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const claveDePrueba = "clave-de-prueba"
+
+// firmado crea un mensaje seguro con el timestamp indicado, ya firmado
+func firmado(from, to, content string, timestamp int64, nonce string) *SecureMessage {
+	msg := &SecureMessage{From: from, To: to, Content: content, Timestamp: timestamp, Nonce: nonce}
+	msg.Signature = signSecureMessage(msg, claveDePrueba)
+	return msg
+}
+
+func TestSecureMessageRoundTrip(t *testing.T) {
+	msg, err := CreateSecureMessage("n0", "n1", "hola", claveDePrueba)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Nonce == "" {
+		t.Fatal("mensaje sin nonce")
+	}
+	if err := VerifySecureMessage(msg, claveDePrueba); err != nil {
+		t.Fatalf("mensaje válido rechazado: %v", err)
+	}
+	if err := VerifySecureMessage(msg, "otra-clave"); err == nil {
+		t.Error("se aceptó un mensaje firmado con otra clave")
+	}
+}
+
+func TestSecureMessageTampering(t *testing.T) {
+	now := time.Now().Unix()
+	cambios := map[string]func(m *SecureMessage){
+		"from":      func(m *SecureMessage) { m.From = "n9" },
+		"to":        func(m *SecureMessage) { m.To = "n9" },
+		"content":   func(m *SecureMessage) { m.Content = "adiós" },
+		"timestamp": func(m *SecureMessage) { m.Timestamp++ },
+		"nonce":     func(m *SecureMessage) { m.Nonce = "otro" },
+		// Mover texto entre campos no debe conservar la firma
+		"from/to":       func(m *SecureMessage) { m.From, m.To = "n0:n1", "" },
+		"to/content":    func(m *SecureMessage) { m.To, m.Content = "n1:hola", "" },
+		"content/nonce": func(m *SecureMessage) { m.Content, m.Nonce = "hola:"+m.Nonce, "" },
+	}
+	for nombre, cambiar := range cambios {
+		t.Run(nombre, func(t *testing.T) {
+			msg := firmado("n0", "n1", "hola", now, "abc")
+			cambiar(msg)
+			if err := VerifySecureMessage(msg, claveDePrueba); err == nil {
+				t.Error("se aceptó un mensaje alterado")
+			}
+		})
+	}
+}
+
+func TestSecureMessageFieldBoundaries(t *testing.T) {
+	now := time.Now().Unix()
+	a := firmado("a:b", "c", "x", now, "n")
+	b := firmado("a", "b:c", "x", now, "n")
+	if a.Signature == b.Signature {
+		t.Error("mensajes con campos distintos tienen la misma firma")
+	}
+}
+
+func TestSecureMessageExpiry(t *testing.T) {
+	window := time.Minute
+	casos := map[string]struct {
+		edad   time.Duration
+		valido bool
+	}{
+		"reciente":      {0, true},
+		"en la ventana": {30 * time.Second, true},
+		"expirado":      {2 * time.Minute, false},
+		"futuro":        {-2 * time.Minute, false},
+	}
+	for nombre, c := range casos {
+		t.Run(nombre, func(t *testing.T) {
+			msg := firmado("n0", "n1", "hola", time.Now().Add(-c.edad).Unix(), "abc")
+			err := verifySecureMessage(msg, claveDePrueba, window)
+			if c.valido && err != nil {
+				t.Errorf("mensaje rechazado: %v", err)
+			}
+			if !c.valido && err == nil {
+				t.Error("mensaje aceptado fuera de la ventana")
+			}
+		})
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	cache := NewReplayCache(time.Minute, 10)
+	now := time.Now().Unix()
+
+	msg := firmado("n0", "n1", "hola", now, "abc")
+	if err := cache.Verify(msg, claveDePrueba); err != nil {
+		t.Fatalf("primer envío rechazado: %v", err)
+	}
+	if err := cache.Verify(msg, claveDePrueba); err == nil {
+		t.Error("se aceptó un mensaje repetido")
+	}
+
+	// Remitente y nonce se comparan por separado: "n0:x" con nonce "y" no es
+	// "n0" con nonce "x:y"
+	if err := cache.Verify(firmado("n0", "n1", "hola", now, "x:y"), claveDePrueba); err != nil {
+		t.Fatalf("mensaje nuevo rechazado: %v", err)
+	}
+	if err := cache.Verify(firmado("n0:x", "n1", "hola", now, "y"), claveDePrueba); err != nil {
+		t.Errorf("mensaje de otro remitente rechazado como repetido: %v", err)
+	}
+
+	if err := cache.Verify(firmado("n0", "n1", "hola", now, ""), claveDePrueba); err == nil {
+		t.Error("se aceptó un mensaje sin nonce")
+	}
+	if cache.Len() != 3 {
+		t.Errorf("mensajes recordados = %d, se esperaba 3", cache.Len())
+	}
+}
+
+func TestReplayCacheFull(t *testing.T) {
+	cache := NewReplayCache(time.Minute, 2)
+	now := time.Now().Unix()
+	for _, nonce := range []string{"a", "b"} {
+		if err := cache.Verify(firmado("n0", "n1", "hola", now, nonce), claveDePrueba); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.Verify(firmado("n0", "n1", "hola", now, "c"), claveDePrueba); err == nil {
+		t.Error("se aceptó un mensaje con la caché llena")
+	}
+
+	// Un mensaje expirado se rechaza aunque su nonce sea nuevo
+	if err := cache.Verify(firmado("n0", "n1", "hola", now-120, "viejo"), claveDePrueba); err == nil {
+		t.Error("se aceptó un mensaje expirado")
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	iteraciones := PasswordIterations
+	PasswordIterations = 1000
+	defer func() { PasswordIterations = iteraciones }()
+
+	hash := HashPassword("secreta")
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$1000$") {
+		t.Fatalf("hash = %q", hash)
+	}
+	if hash == HashPassword("secreta") {
+		t.Error("dos hashes de la misma contraseña son iguales: falta la sal")
+	}
+	if !VerifyPassword("secreta", hash) {
+		t.Error("contraseña correcta rechazada")
+	}
+	if VerifyPassword("otra", hash) {
+		t.Error("contraseña incorrecta aceptada")
+	}
+	for _, invalido := range []string{"pbkdf2-sha256$x$a$b", "pbkdf2-sha256$1000$a", "pbkdf2-sha256$1000$!!$b"} {
+		if VerifyPassword("secreta", invalido) {
+			t.Errorf("se aceptó el hash inválido %q", invalido)
+		}
+	}
+	if NeedsRehash(hash) {
+		t.Error("un hash actual requiere actualizarse")
+	}
+	PasswordIterations = 2000
+	if !NeedsRehash(hash) {
+		t.Error("un hash con menos iteraciones no requiere actualizarse")
+	}
+}
+
+func TestLegacyPasswordUpgrade(t *testing.T) {
+	iteraciones := PasswordIterations
+	PasswordIterations = 1000
+	defer func() { PasswordIterations = iteraciones }()
+
+	sum := sha256.Sum256([]byte("secreta"))
+	legacy := hex.EncodeToString(sum[:])
+	if !VerifyPassword("secreta", legacy) || !NeedsRehash(legacy) {
+		t.Fatal("el hash SHA-256 anterior no se acepta o no requiere actualizarse")
+	}
+	ok, nuevo := VerifyAndUpgrade("secreta", legacy)
+	if !ok || !VerifyPassword("secreta", nuevo) || NeedsRehash(nuevo) {
+		t.Errorf("actualización = %t, %q", ok, nuevo)
+	}
+	if ok, nuevo := VerifyAndUpgrade("otra", legacy); ok || nuevo != "" {
+		t.Error("se actualizó el hash con una contraseña incorrecta")
+	}
+}
+
+func TestToken(t *testing.T) {
+	token := GenerateToken("admin:nodo.1", claveDePrueba)
+	ok, nodeID := ValidateToken(token, claveDePrueba)
+	if !ok || nodeID != "admin:nodo.1" {
+		t.Fatalf("token válido rechazado: %t, %q", ok, nodeID)
+	}
+	if ok, _ := ValidateToken(token, "otra-clave"); ok {
+		t.Error("se aceptó un token firmado con otra clave")
+	}
+	if ok, _ := ValidateToken("no es base64", claveDePrueba); ok {
+		t.Error("se aceptó un token mal formado")
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	// firmarToken arma un token emitido en la hora indicada
+	firmarToken := func(emitido time.Time) string {
+		data := fmt.Sprintf("admin:%d", emitido.Unix())
+		return base64.StdEncoding.EncodeToString([]byte(data + "." + signToken(data, claveDePrueba)))
+	}
+	casos := map[string]struct {
+		emitido time.Time
+		valido  bool
+	}{
+		"vigente": {time.Now().Add(-TokenTTL / 2), true},
+		"vencido": {time.Now().Add(-TokenTTL - time.Minute), false},
+		"futuro":  {time.Now().Add(2 * time.Minute), false},
+	}
+	for nombre, c := range casos {
+		t.Run(nombre, func(t *testing.T) {
+			if ok, _ := ValidateToken(firmarToken(c.emitido), claveDePrueba); ok != c.valido {
+				t.Errorf("válido = %t, se esperaba %t", ok, c.valido)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sync"
+)
+
+// SessionManager deriva una clave de sesión distinta para cada par de nodos
+// mediante ECDH (X25519). Un nodo comprometido solo conoce sus propias claves
+// de sesión y no puede descifrar el tráfico entre otros dos nodos.
+//
+// El intercambio de claves públicas no está autenticado por sí mismo: el nodo
+// lo acepta solo sobre TLS mutuo y toma la identidad del par de su certificado.
+type SessionManager struct {
+	mu      sync.RWMutex
+	self    string              // Identificador del nodo local (dirección)
+	private *ecdh.PrivateKey    // Par ECDH actual del nodo
+	peers   map[string]*Keyring // Llavero de sesión por cada par
+	retain  int                 // Versiones conservadas por llavero
+}
+
+// NewSessionManager crea un gestor de sesiones con un par ECDH nuevo
+func NewSessionManager(self string) (*SessionManager, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionManager{
+		self:    self,
+		private: private,
+		peers:   make(map[string]*Keyring),
+		retain:  3,
+	}, nil
+}
+
+// PublicKey retorna la clave pública ECDH actual codificada en base64
+func (s *SessionManager) PublicKey() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return encodePublicKey(s.private)
+}
+
+// Rotate reemplaza el par ECDH local. Las sesiones existentes siguen siendo
+// válidas hasta que se renegocien.
+func (s *SessionManager) Rotate() error {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.private = private
+	s.mu.Unlock()
+	return nil
+}
+
+// Accept atiende un intercambio de claves iniciado por un par: deriva una
+// nueva versión de la clave de sesión a partir de su clave pública (base64) y
+// retorna el identificador de la clave y la clave pública local con la que se
+// derivó, ambas con el mismo par ECDH aunque haya una rotación en curso
+func (s *SessionManager) Accept(peer, publicKey string) (keyID, localPublic string, err error) {
+	remote, err := parsePublicKey(peer, publicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keyID, err = s.establish(s.private, peer, remote)
+	if err != nil {
+		return "", "", err
+	}
+	return keyID, encodePublicKey(s.private), nil
+}
+
+// Handshake es un intercambio de claves iniciado por el nodo local. Conserva
+// el par ECDH con el que se envió la clave pública, para que una rotación
+// durante el intercambio no combine claves distintas.
+type Handshake struct {
+	s       *SessionManager
+	peer    string
+	private *ecdh.PrivateKey
+}
+
+// StartHandshake inicia un intercambio de claves con un par
+func (s *SessionManager) StartHandshake(peer string) *Handshake {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &Handshake{s: s, peer: peer, private: s.private}
+}
+
+// PublicKey retorna la clave pública que se envía al par
+func (h *Handshake) PublicKey() string {
+	return encodePublicKey(h.private)
+}
+
+// Finish deriva la clave de sesión con la clave pública con la que respondió
+// el par y retorna el identificador de la clave
+func (h *Handshake) Finish(publicKey string) (string, error) {
+	remote, err := parsePublicKey(h.peer, publicKey)
+	if err != nil {
+		return "", err
+	}
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+	return h.s.establish(h.private, h.peer, remote)
+}
+
+// establish deriva una nueva versión de la clave de sesión con un par y la
+// agrega a su llavero. Debe llamarse con mu tomado.
+func (s *SessionManager) establish(private *ecdh.PrivateKey, peer string, remote *ecdh.PublicKey) (string, error) {
+	shared, err := private.ECDH(remote)
+	if err != nil {
+		return "", err
+	}
+
+	// La información de derivación incluye ambos nodos en orden fijo para que
+	// los dos extremos obtengan la misma clave
+	first, second := s.self, peer
+	if second < first {
+		first, second = second, first
+	}
+	key, err := hkdf.Key(sha256.New, shared, nil, "solemne3 session "+first+"|"+second, 32)
+	if err != nil {
+		return "", err
+	}
+
+	ring, ok := s.peers[peer]
+	if !ok {
+		ring = NewKeyring(s.retain)
+		s.peers[peer] = ring
+	}
+	return ring.Add(key)
+}
+
+// parsePublicKey interpreta una clave pública ECDH codificada en base64
+func parsePublicKey(peer, publicKey string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("clave pública inválida de %s: %w", peer, err)
+	}
+	remote, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("clave pública inválida de %s: %w", peer, err)
+	}
+	return remote, nil
+}
+
+// encodePublicKey codifica en base64 la clave pública de un par ECDH
+func encodePublicKey(private *ecdh.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(private.PublicKey().Bytes())
+}
+
+// HasSession indica si existe una clave de sesión con el par
+func (s *SessionManager) HasSession(peer string) bool {
+	_, ok := s.keyring(peer)
+	return ok
+}
+
+// Encrypt cifra un mensaje con la clave de sesión actual del par
+func (s *SessionManager) Encrypt(peer, plaintext string) (string, error) {
+	ring, ok := s.keyring(peer)
+	if !ok {
+		return "", fmt.Errorf("no hay sesión establecida con %s", peer)
+	}
+	return ring.Encrypt(plaintext)
+}
+
+// Decrypt descifra un mensaje recibido de un par
+func (s *SessionManager) Decrypt(peer, cipherText string) (string, error) {
+	ring, ok := s.keyring(peer)
+	if !ok {
+		return "", fmt.Errorf("no hay sesión establecida con %s", peer)
+	}
+	return ring.Decrypt(cipherText)
+}
+
+// keyring obtiene el llavero de sesión de un par
+func (s *SessionManager) keyring(peer string) (*Keyring, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ring, ok := s.peers[peer]
+	return ring, ok
+}